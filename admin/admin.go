@@ -0,0 +1,271 @@
+// Package admin serves an http.Handler that shows what a running process has
+// loaded: every runtime key with its value, snapshot metadata and, for
+// loaders that report it, the status of the most recent reload.
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lyft/goruntime/loader"
+	"github.com/lyft/goruntime/snapshot"
+)
+
+// RedactedValue replaces the value of redacted keys.
+const RedactedValue = "<redacted>"
+
+// Report is the JSON representation of a loader.
+type Report struct {
+	Keys     []Key             `json:"keys"`
+	Metadata map[string]string `json:"metadata"`
+	// Status is only set for loaders that report one, such as *loader.Loader.
+	Status *Status `json:"status,omitempty"`
+}
+
+// Key is a runtime key in a Report.
+type Key struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	// Integer is set if the value parses as an integer.
+	Integer  *uint64   `json:"integer,omitempty"`
+	Modified time.Time `json:"modified"`
+	Redacted bool      `json:"redacted,omitempty"`
+}
+
+// Status is the status of a loader in a Report.
+type Status struct {
+	LoadedAt   time.Time `json:"loaded_at"`
+	NumValues  int       `json:"num_values"`
+	Generation uint64    `json:"generation"`
+	LastError  string    `json:"last_error,omitempty"`
+	// Problems lists the key collisions, limit and path violations, validation
+	// errors and unreadable files of the most recent reload.
+	Problems []string `json:"problems,omitempty"`
+	// Loads is only set for loaders that report load stats, such as *loader.Loader.
+	Loads *Loads `json:"loads,omitempty"`
+}
+
+// Loads are the load stats of a loader since it was created.
+type Loads struct {
+	Attempts      uint64 `json:"attempts"`
+	Failures      uint64 `json:"failures"`
+	Rejections    uint64 `json:"rejections"`
+	KeyCollisions uint64 `json:"key_collisions"`
+}
+
+type statusLoader interface {
+	Status() loader.Status
+}
+
+type generationLoader interface {
+	Generation() uint64
+}
+
+type loadStatsLoader interface {
+	LoadStats() loader.LoadStats
+}
+
+// Handler serves the state of a loader. The response format is chosen by the
+// "format" query parameter, one of "json", "html" or "text", falling back to
+// the Accept header and then to text. The "prefix" query parameter limits the
+// keys shown to those starting with it.
+type Handler struct {
+	loader loader.IFace
+	redact []*regexp.Regexp
+}
+
+type Option func(h *Handler)
+
+// Redact hides the values of keys matching any of patterns.
+func Redact(patterns ...*regexp.Regexp) Option {
+	return func(h *Handler) { h.redact = append(h.redact, patterns...) }
+}
+
+func NewHandler(l loader.IFace, opts ...Option) *Handler {
+	h := &Handler{loader: l}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// Report builds the report served for keys starting with prefix.
+func (h *Handler) Report(prefix string) *Report {
+	report := &Report{Keys: []Key{}, Metadata: map[string]string{}}
+
+	// Keys and metadata are read from one snapshot, so they always match.
+	loader.ViewOf(h.loader, func(s snapshot.IFace) {
+		for key, e := range s.Entries() {
+			if !strings.HasPrefix(key, prefix) {
+				continue
+			}
+			k := Key{Key: key, Value: e.StringValue, Modified: e.Modified}
+			if h.redacted(key) {
+				k.Value = RedactedValue
+				k.Redacted = true
+			} else if e.Uint64Valid {
+				n := e.Uint64Value
+				k.Integer = &n
+			}
+			report.Keys = append(report.Keys, k)
+		}
+		for key, value := range snapshot.Metadata(s) {
+			report.Metadata[key] = value
+		}
+	})
+	sort.Slice(report.Keys, func(i, j int) bool { return report.Keys[i].Key < report.Keys[j].Key })
+
+	if l, ok := h.loader.(statusLoader); ok {
+		report.Status = newStatus(l.Status())
+		if g, ok := h.loader.(generationLoader); ok {
+			report.Status.Generation = g.Generation()
+		}
+		if s, ok := h.loader.(loadStatsLoader); ok {
+			stats := s.LoadStats()
+			report.Status.Loads = &Loads{
+				Attempts:      stats.LoadAttempts,
+				Failures:      stats.LoadFailures,
+				Rejections:    stats.LoadRejections,
+				KeyCollisions: stats.KeyCollisions,
+			}
+		}
+	}
+	return report
+}
+
+func (h *Handler) redacted(key string) bool {
+	for _, pattern := range h.redact {
+		if pattern.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+func newStatus(s loader.Status) *Status {
+	status := &Status{LoadedAt: s.LoadedAt, NumValues: s.NumValues, Problems: s.Problems()}
+	if s.LastError != nil {
+		status.LastError = s.LastError.Error()
+	}
+	return status
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	report := h.Report(r.URL.Query().Get("prefix"))
+
+	switch format(r) {
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+	case "html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		htmlTemplate.Execute(w, report)
+	default:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		writeText(w, report)
+	}
+}
+
+func format(r *http.Request) string {
+	switch f := r.URL.Query().Get("format"); f {
+	case "json", "html", "text":
+		return f
+	}
+	accept := r.Header.Get("Accept")
+	switch {
+	case strings.Contains(accept, "application/json"):
+		return "json"
+	case strings.Contains(accept, "text/html"):
+		return "html"
+	default:
+		return "text"
+	}
+}
+
+func writeText(w http.ResponseWriter, report *Report) {
+	if s := report.Status; s != nil {
+		fmt.Fprintf(w, "loaded at:  %s\n", s.LoadedAt.Format(time.RFC3339))
+		fmt.Fprintf(w, "values:     %d\n", s.NumValues)
+		fmt.Fprintf(w, "generation: %d\n", s.Generation)
+		if s.LastError != "" {
+			fmt.Fprintf(w, "last error: %s\n", s.LastError)
+		}
+		if l := s.Loads; l != nil {
+			fmt.Fprintf(w, "loads:      %d attempts, %d failures, %d rejections, %d key collisions\n",
+				l.Attempts, l.Failures, l.Rejections, l.KeyCollisions)
+		}
+		for _, problem := range s.Problems {
+			fmt.Fprintf(w, "problem:    %s\n", problem)
+		}
+		fmt.Fprintln(w)
+	}
+
+	if len(report.Metadata) > 0 {
+		keys := make([]string, 0, len(report.Metadata))
+		for key := range report.Metadata {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(w, "%s: %s\n", key, report.Metadata[key])
+		}
+		fmt.Fprintln(w)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tVALUE\tINTEGER\tMODIFIED")
+	for _, k := range report.Keys {
+		value := fmt.Sprintf("%q", k.Value)
+		if k.Redacted {
+			value = k.Value
+		}
+		integer := "-"
+		if k.Integer != nil {
+			integer = fmt.Sprint(*k.Integer)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", k.Key, value, integer, k.Modified.Format(time.RFC3339))
+	}
+	tw.Flush()
+}
+
+var htmlTemplate = template.Must(template.New("runtime").Parse(`<!DOCTYPE html>
+<html>
+<head><title>runtime</title></head>
+<body>
+{{with .Status}}
+<h2>Status</h2>
+<table>
+<tr><th>Loaded at</th><td>{{.LoadedAt}}</td></tr>
+<tr><th>Values</th><td>{{.NumValues}}</td></tr>
+<tr><th>Generation</th><td>{{.Generation}}</td></tr>
+{{if .LastError}}<tr><th>Last error</th><td>{{.LastError}}</td></tr>{{end}}
+{{with .Loads}}<tr><th>Load attempts</th><td>{{.Attempts}}</td></tr>
+<tr><th>Load failures</th><td>{{.Failures}}</td></tr>
+<tr><th>Load rejections</th><td>{{.Rejections}}</td></tr>
+<tr><th>Key collisions</th><td>{{.KeyCollisions}}</td></tr>{{end}}
+</table>
+{{if .Problems}}<ul>{{range .Problems}}<li>{{.}}</li>{{end}}</ul>{{end}}
+{{end}}
+{{if .Metadata}}
+<h2>Metadata</h2>
+<table>
+{{range $key, $value := .Metadata}}<tr><th>{{$key}}</th><td>{{$value}}</td></tr>
+{{end}}</table>
+{{end}}
+<h2>Keys</h2>
+<table>
+<tr><th>Key</th><th>Value</th><th>Integer</th><th>Modified</th></tr>
+{{range .Keys}}<tr><td>{{.Key}}</td><td>{{if .Redacted}}<i>{{.Value}}</i>{{else}}<pre>{{.Value}}</pre>{{end}}</td><td>{{with .Integer}}{{.}}{{else}}-{{end}}</td><td>{{.Modified}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
@@ -0,0 +1,120 @@
+package admin_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/lyft/goruntime/admin"
+	"github.com/lyft/goruntime/loader"
+	"github.com/lyft/goruntime/snapshot"
+	stats "github.com/lyft/gostats"
+	"github.com/stretchr/testify/require"
+)
+
+func newLoader(t *testing.T, files map[string]string) (loader.IFace, func()) {
+	dir, err := ioutil.TempDir("", "admin_test")
+	require.NoError(t, err)
+	for name, value := range files {
+		path := filepath.Join(dir, "app", name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, ioutil.WriteFile(path, []byte(value), 0644))
+	}
+	l, err := loader.New2(dir, "app", stats.NewStore(stats.NewNullSink(), false), &loader.DirectoryRefresher{}, loader.MaxKeys(4))
+	require.NoError(t, err)
+	return l, func() {
+		l.(*loader.Loader).Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func get(h *admin.Handler, url string, accept string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", url, nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestJSON(t *testing.T) {
+	assert := require.New(t)
+
+	l, cleanup := newLoader(t, map[string]string{
+		"svc/timeout_ms": "250\n",
+		"svc/mode":       "fast",
+		"db/password":    "hunter2",
+		"other":          "1",
+		"zz":             "over the key limit",
+	})
+	defer cleanup()
+
+	h := admin.NewHandler(l, admin.Redact(regexp.MustCompile(`password`)))
+	w := get(h, "/?format=json", "")
+	assert.Equal("application/json", w.Header().Get("Content-Type"))
+
+	var report admin.Report
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &report))
+	assert.Len(report.Keys, 4)
+	assert.Equal("db.password", report.Keys[0].Key)
+	assert.Equal(admin.RedactedValue, report.Keys[0].Value)
+	assert.True(report.Keys[0].Redacted)
+	assert.Nil(report.Keys[0].Integer)
+
+	assert.NotNil(report.Status)
+	assert.Equal(4, report.Status.NumValues)
+	assert.NotZero(report.Status.Generation)
+	assert.Len(report.Status.Problems, 1)
+	assert.Contains(report.Status.Problems[0], "keys limit")
+	assert.NotNil(report.Status.Loads)
+	assert.NotZero(report.Status.Loads.Attempts)
+	assert.Zero(report.Status.Loads.Rejections)
+	assert.Regexp(`loads:\s+\d+ attempts, 0 failures, 0 rejections, 0 key collisions`, get(h, "/", "").Body.String())
+
+	w = get(h, "/?prefix=svc.", "application/json")
+	report = admin.Report{}
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &report))
+	assert.Len(report.Keys, 2)
+	assert.Equal("svc.mode", report.Keys[0].Key)
+	assert.Nil(report.Keys[0].Integer)
+	assert.Equal("svc.timeout_ms", report.Keys[1].Key)
+	assert.Equal("250\n", report.Keys[1].Value)
+	assert.Equal(uint64(250), *report.Keys[1].Integer)
+}
+
+func TestText(t *testing.T) {
+	assert := require.New(t)
+
+	s := snapshot.NewMock().Set("token", "secret").SetUInt64("limit", 5)
+	s.SetMetadata("rtds.version", "v7")
+	h := admin.NewHandler(staticLoader{s}, admin.Redact(regexp.MustCompile(`^token$`)))
+
+	w := get(h, "/", "")
+	assert.Equal("text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+	body := w.Body.String()
+	assert.Contains(body, "rtds.version: v7")
+	assert.Regexp(`limit\s+""\s+5`, body)
+	assert.Contains(body, admin.RedactedValue)
+	assert.NotContains(body, "secret")
+	assert.NotContains(body, "generation")
+	assert.NotContains(body, "loads:")
+
+	w = get(h, "/", "text/html")
+	assert.Equal("text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	body = w.Body.String()
+	assert.Contains(body, "<td>limit</td>")
+	assert.Contains(body, "<td>5</td>")
+	assert.NotContains(body, "secret")
+}
+
+type staticLoader struct {
+	snapshot snapshot.IFace
+}
+
+func (s staticLoader) Snapshot() snapshot.IFace            { return s.snapshot }
+func (staticLoader) AddUpdateCallback(callback chan<- int) {}
@@ -0,0 +1,88 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/lyft/goruntime/loader"
+)
+
+// HealthReport is the JSON representation of a loader.Health.
+type HealthReport struct {
+	Healthy    bool      `json:"healthy"`
+	Failures   []string  `json:"failures,omitempty"`
+	Loaded     bool      `json:"loaded"`
+	LoadedAt   time.Time `json:"loaded_at"`
+	Watching   bool      `json:"watching"`
+	LastError  string    `json:"last_error,omitempty"`
+	Path       string    `json:"path,omitempty"`
+	PathExists bool      `json:"path_exists"`
+}
+
+// HealthChecker is a loader that reports its health, such as *loader.Loader.
+type HealthChecker interface {
+	Health() loader.Health
+}
+
+// HealthHandler serves the health of a loader for readiness probes. It
+// responds with 200 OK if the loader is healthy and 503 Service Unavailable
+// otherwise, with a body in the format chosen as for Handler.
+type HealthHandler struct {
+	loader HealthChecker
+}
+
+func NewHealthHandler(l HealthChecker) *HealthHandler {
+	return &HealthHandler{loader: l}
+}
+
+func newHealthReport(h loader.Health) *HealthReport {
+	report := &HealthReport{
+		Healthy:    h.Healthy,
+		Failures:   h.Failures,
+		Loaded:     h.Loaded,
+		LoadedAt:   h.LoadedAt,
+		Watching:   h.Watching,
+		Path:       h.Path,
+		PathExists: h.PathExists,
+	}
+	if h.LastError != nil {
+		report.LastError = h.LastError.Error()
+	}
+	return report
+}
+
+func (h *HealthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	report := newHealthReport(h.loader.Health())
+	code := http.StatusOK
+	if !report.Healthy {
+		code = http.StatusServiceUnavailable
+	}
+
+	if format(r) == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(code)
+	if report.Healthy {
+		fmt.Fprintln(w, "ok")
+	} else {
+		fmt.Fprintln(w, "unhealthy")
+	}
+	for _, failure := range report.Failures {
+		fmt.Fprintf(w, "failure:    %s\n", failure)
+	}
+	if report.Loaded {
+		fmt.Fprintf(w, "loaded at:  %s\n", report.LoadedAt.Format(time.RFC3339))
+	}
+	if report.LastError != "" {
+		fmt.Fprintf(w, "last error: %s\n", report.LastError)
+	}
+}
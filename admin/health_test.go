@@ -0,0 +1,50 @@
+package admin_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lyft/goruntime/admin"
+	"github.com/lyft/goruntime/loader"
+	"github.com/stretchr/testify/require"
+)
+
+type healthChecker loader.Health
+
+func (h healthChecker) Health() loader.Health { return loader.Health(h) }
+
+func TestHealthHandler(t *testing.T) {
+	assert := require.New(t)
+
+	serve := func(h loader.Health, url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		admin.NewHealthHandler(healthChecker(h)).ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		return w
+	}
+
+	l, cleanup := newLoader(t, map[string]string{"key": "value"})
+	defer cleanup()
+	w := httptest.NewRecorder()
+	admin.NewHealthHandler(l.(*loader.Loader)).ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Body.String(), "ok\n")
+
+	w = serve(loader.Health{
+		Failures:  []string{"stopped watching for changes"},
+		Loaded:    true,
+		LastError: errors.New("boom"),
+		Path:      "/runtime/app",
+	}, "/healthz")
+	assert.Equal(http.StatusServiceUnavailable, w.Code)
+	assert.Equal("unhealthy\nfailure:    stopped watching for changes\nloaded at:  0001-01-01T00:00:00Z\nlast error: boom\n", w.Body.String())
+
+	w = serve(loader.Health{Failures: []string{"no snapshot has been loaded"}, Path: "/runtime/app"}, "/healthz?format=json")
+	assert.Equal(http.StatusServiceUnavailable, w.Code)
+	assert.Equal("application/json", w.Header().Get("Content-Type"))
+	var report admin.HealthReport
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &report))
+	assert.Equal(admin.HealthReport{Failures: []string{"no snapshot has been loaded"}, Path: "/runtime/app"}, report)
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/lyft/goruntime/snapshot"
+)
+
+// diffValue is one side of a changed key.
+type diffValue struct {
+	Value string `json:"value"`
+	// Integer is set if the value parses as an integer.
+	Integer *uint64 `json:"integer,omitempty"`
+}
+
+// percentageChange is a feature percentage that moved.
+type percentageChange struct {
+	Old uint64 `json:"old"`
+	New uint64 `json:"new"`
+}
+
+type keyDiff struct {
+	Key string     `json:"key"`
+	Old *diffValue `json:"old,omitempty"`
+	New *diffValue `json:"new,omitempty"`
+	// Percentage is set for feature keys whose effective percentage, as used
+	// by FeatureEnabled, changed.
+	Percentage *percentageChange `json:"percentage,omitempty"`
+}
+
+type diffResult struct {
+	Added   []keyDiff `json:"added"`
+	Removed []keyDiff `json:"removed"`
+	Changed []keyDiff `json:"changed"`
+}
+
+func (d *diffResult) empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+func newDiffValue(s snapshot.IFace, key string) *diffValue {
+	e, ok := s.Entries()[key]
+	if !ok {
+		return nil
+	}
+	v := &diffValue{Value: e.StringValue}
+	if e.Uint64Valid {
+		n := e.Uint64Value
+		v.Integer = &n
+	}
+	return v
+}
+
+// diffSnapshots compares two snapshots. Percentage moves are reported for
+// keys starting with any of featurePrefixes, or for every key if there are none.
+func diffSnapshots(old snapshot.IFace, new snapshot.IFace, featurePrefixes []string) *diffResult {
+	keys := map[string]bool{}
+	for key := range old.Entries() {
+		keys[key] = true
+	}
+	for key := range new.Entries() {
+		keys[key] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+
+	d := &diffResult{Added: []keyDiff{}, Removed: []keyDiff{}, Changed: []keyDiff{}}
+	for _, key := range sorted {
+		kd := keyDiff{Key: key, Old: newDiffValue(old, key), New: newDiffValue(new, key)}
+		switch {
+		case kd.Old == nil:
+			d.Added = append(d.Added, kd)
+		case kd.New == nil:
+			d.Removed = append(d.Removed, kd)
+		case kd.Old.Value != kd.New.Value:
+			if isFeature(key, featurePrefixes) && kd.Old.Integer != nil && kd.New.Integer != nil {
+				oldPercent, newPercent := percentage(*kd.Old.Integer), percentage(*kd.New.Integer)
+				if oldPercent != newPercent {
+					kd.Percentage = &percentageChange{Old: oldPercent, New: newPercent}
+				}
+			}
+			d.Changed = append(d.Changed, kd)
+		}
+	}
+	return d
+}
+
+func isFeature(key string, prefixes []string) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// percentage is the share of calls FeatureEnabled enables for value.
+func percentage(value uint64) uint64 {
+	if value > 100 {
+		return 100
+	}
+	return value
+}
+
+func (v *diffValue) String() string {
+	return fmt.Sprintf("%q", v.Value)
+}
+
+func (v *diffValue) integerString() string {
+	if v.Integer == nil {
+		return "not an integer"
+	}
+	return fmt.Sprint(*v.Integer)
+}
+
+func (d *diffResult) writeText(w io.Writer) {
+	for _, kd := range d.Added {
+		fmt.Fprintf(w, "+ %s = %s\n", kd.Key, kd.New)
+	}
+	for _, kd := range d.Removed {
+		fmt.Fprintf(w, "- %s = %s\n", kd.Key, kd.Old)
+	}
+	for _, kd := range d.Changed {
+		fmt.Fprintf(w, "~ %s: %s -> %s\n", kd.Key, kd.Old, kd.New)
+		if (kd.Old.Integer == nil) != (kd.New.Integer == nil) {
+			fmt.Fprintf(w, "    integer: %s -> %s\n", kd.Old.integerString(), kd.New.integerString())
+		}
+		if kd.Percentage != nil {
+			fmt.Fprintf(w, "    feature: %d%% -> %d%%\n", kd.Percentage.Old, kd.Percentage.New)
+		}
+	}
+	fmt.Fprintf(w, "%d added, %d removed, %d changed\n", len(d.Added), len(d.Removed), len(d.Changed))
+}
+
+// splitTree splits a "path@ref" argument. Without "@" the files on disk are used.
+func splitTree(arg string) (path string, ref string) {
+	if i := strings.LastIndex(arg, "@"); i >= 0 {
+		path, ref = arg[:i], arg[i+1:]
+		if path == "" {
+			path = "."
+		}
+		return path, ref
+	}
+	return arg, ""
+}
+
+type stringList []string
+
+func (l *stringList) String() string     { return strings.Join(*l, ",") }
+func (l *stringList) Set(v string) error { *l = append(*l, v); return nil }
+
+func runDiff(args []string, stdout io.Writer, stderr io.Writer) int {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var flags loadFlags
+	flags.register(fs)
+	asJSON := fs.Bool("json", false, "print the diff as JSON")
+	var features stringList
+	fs.Var(&features, "features", "key prefix of feature percentage keys, may be repeated; all keys if unset")
+	if err := fs.Parse(args); err != nil {
+		return exitError
+	}
+	if fs.NArg() != 3 {
+		fmt.Fprintln(stderr, "usage: goruntime diff [flags] <old path>[@<git ref>] <new path>[@<git ref>] <subdirectory>")
+		fs.PrintDefaults()
+		return exitError
+	}
+
+	var snapshots [2]snapshot.IFace
+	for i, arg := range fs.Args()[:2] {
+		treeFlags := flags
+		path, ref := splitTree(arg)
+		if ref != "" {
+			treeFlags.gitRef = ref
+		}
+		t, err := treeFlags.load(path, fs.Arg(2))
+		if err != nil {
+			fmt.Fprintf(stderr, "goruntime: %s: %s\n", arg, err)
+			return exitError
+		}
+		for _, problem := range t.problems {
+			fmt.Fprintf(stderr, "%s: problem: %s\n", arg, problem)
+		}
+		snapshots[i] = t.loader.Snapshot()
+	}
+
+	d := diffSnapshots(snapshots[0], snapshots[1], features)
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(d)
+	} else {
+		d.writeText(stdout)
+	}
+
+	// Like diff(1), report differences in the exit status.
+	if d.empty() {
+		return exitOK
+	}
+	return exitProblems
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lyft/goruntime/loader/git/gittest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	assert := require.New(t)
+
+	old := writeTree(t, map[string]string{
+		"app/removed":         "x",
+		"app/same":            "1",
+		"app/timeout_ms":      "250",
+		"app/feature/rollout": "5",
+		"app/feature/full":    "150",
+		"app/limit":           "10",
+	})
+	defer os.RemoveAll(old)
+	new := writeTree(t, map[string]string{
+		"app/added":           "y",
+		"app/same":            "1",
+		"app/timeout_ms":      "500",
+		"app/feature/rollout": "50",
+		"app/feature/full":    "200",
+		"app/limit":           "ten",
+	})
+	defer os.RemoveAll(new)
+
+	code, stdout, stderr := runCommand("diff", "-features", "feature.", old, new, "app")
+	assert.Equal(exitProblems, code, stderr)
+	assert.Equal(`+ added = "y"
+- removed = "x"
+~ feature.full: "150" -> "200"
+~ feature.rollout: "5" -> "50"
+    feature: 5% -> 50%
+~ limit: "10" -> "ten"
+    integer: 10 -> not an integer
+~ timeout_ms: "250" -> "500"
+1 added, 1 removed, 4 changed
+`, stdout)
+
+	code, stdout, _ = runCommand("diff", "-json", old, new, "app")
+	assert.Equal(exitProblems, code)
+	var d diffResult
+	assert.NoError(json.Unmarshal([]byte(stdout), &d))
+	assert.Len(d.Changed, 4)
+	assert.Equal(&percentageChange{Old: 5, New: 50}, d.Changed[1].Percentage)
+	// Without -features every key is treated as a percentage, and values over
+	// 100 are clamped, so neither of these moved.
+	assert.Nil(d.Changed[0].Percentage)
+	assert.Nil(d.Changed[3].Percentage)
+
+	code, stdout, _ = runCommand("diff", old, old, "app")
+	assert.Equal(exitOK, code)
+	assert.Equal("0 added, 0 removed, 0 changed\n", stdout)
+}
+
+func TestDiffGitRevisions(t *testing.T) {
+	assert := require.New(t)
+
+	gittest.SkipIfMissing(t)
+
+	dir := writeTree(t, map[string]string{"app/key": "1"})
+	defer os.RemoveAll(dir)
+	git := func(args ...string) { gittest.Run(t, dir, nil, args...) }
+	git("init", "-q")
+	git("add", "-A")
+	git("commit", "-q", "-m", "first")
+	assert.NoError(ioutil.WriteFile(filepath.Join(dir, "app/key"), []byte("2"), 0644))
+	git("commit", "-q", "-a", "-m", "second")
+
+	code, stdout, stderr := runCommand("diff", dir+"@HEAD~1", dir+"@HEAD", "app")
+	assert.Equal(exitProblems, code, stderr)
+	assert.Contains(stdout, `~ key: "1" -> "2"`)
+}
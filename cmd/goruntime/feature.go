@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/lyft/goruntime/snapshot"
+)
+
+type featureResult struct {
+	Key        string `json:"key"`
+	Percentage uint64 `json:"percentage"`
+	// Source describes where Percentage came from.
+	Source string       `json:"source"`
+	IDs    []featureID  `json:"ids"`
+	Steps  featureSteps `json:"steps,omitempty"`
+}
+
+type featureID struct {
+	ID      uint64 `json:"id"`
+	Enabled bool   `json:"enabled"`
+	Bucket  uint32 `json:"bucket"`
+	// EnabledAt is the smallest percentage, or rollout step if there are
+	// steps, at which the feature is enabled for ID. It is unset if none of
+	// the steps enable it.
+	EnabledAt *uint32 `json:"enabled_at"`
+}
+
+// featureSteps are rollout percentages in ascending order.
+type featureSteps []uint32
+
+func (s *featureSteps) String() string {
+	parts := make([]string, len(*s))
+	for i, step := range *s {
+		parts[i] = fmt.Sprint(step)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (s *featureSteps) Set(v string) error {
+	var steps featureSteps
+	for _, part := range strings.Split(v, ",") {
+		step, err := strconv.ParseUint(strings.TrimSpace(part), 10, 32)
+		if err != nil || step > 100 {
+			return fmt.Errorf("invalid rollout step %q: must be a percentage from 0 to 100", part)
+		}
+		steps = append(steps, uint32(step))
+	}
+	sort.Slice(steps, func(i, j int) bool { return steps[i] < steps[j] })
+	*s = steps
+	return nil
+}
+
+// enabledAt returns the first step at which an ID in bucket is enabled, or,
+// without steps, the smallest such percentage.
+func (s featureSteps) enabledAt(bucket uint32) *uint32 {
+	if len(s) == 0 {
+		p := bucket + 1
+		return &p
+	}
+	for _, step := range s {
+		if bucket < step {
+			p := step
+			return &p
+		}
+	}
+	return nil
+}
+
+// readIDs reads one ID per line from path, skipping blank lines and lines
+// starting with "#".
+func readIDs(path string) ([]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var ids []uint64
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		id, err := strconv.ParseUint(text, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid ID %q", path, line, text)
+		}
+		ids = append(ids, id)
+	}
+	return ids, scanner.Err()
+}
+
+// simulateFeature evaluates key for ids exactly as FeatureEnabledForID does
+// with s, or with percentage in place of the runtime value if it is not negative.
+func simulateFeature(s snapshot.IFace, key string, ids []uint64, defaultPercentage uint32, percentage int64, steps featureSteps) *featureResult {
+	r := &featureResult{Key: key, IDs: []featureID{}, Steps: steps}
+	switch e, ok := s.Entries()[key]; {
+	case percentage >= 0:
+		// An empty snapshot makes FeatureEnabledForID use the percentage as
+		// the default.
+		s = snapshot.New()
+		defaultPercentage = uint32(percentage)
+		r.Percentage, r.Source = uint64(percentage), "simulated"
+	case !ok:
+		r.Percentage, r.Source = uint64(defaultPercentage), "default, key is not set"
+	case !e.Uint64Valid:
+		r.Percentage, r.Source = uint64(defaultPercentage), fmt.Sprintf("default, %q is not an integer", e.StringValue)
+	default:
+		r.Percentage, r.Source = e.Uint64Value, "runtime value"
+	}
+
+	for _, id := range ids {
+		bucket := snapshot.Bucket(id, key)
+		r.IDs = append(r.IDs, featureID{
+			ID:        id,
+			Enabled:   s.FeatureEnabledForID(key, id, defaultPercentage),
+			Bucket:    bucket,
+			EnabledAt: steps.enabledAt(bucket),
+		})
+	}
+	return r
+}
+
+func (r *featureResult) writeText(w io.Writer) {
+	fmt.Fprintf(w, "%s at %d%% (%s)\n", r.Key, r.Percentage, r.Source)
+	if len(r.IDs) == 0 {
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tENABLED\tBUCKET\tENABLED AT")
+	for _, id := range r.IDs {
+		enabledAt := "never"
+		if id.EnabledAt != nil {
+			enabledAt = fmt.Sprintf("%d%%", *id.EnabledAt)
+		}
+		fmt.Fprintf(tw, "%d\t%t\t%d\t%s\n", id.ID, id.Enabled, id.Bucket, enabledAt)
+	}
+	tw.Flush()
+}
+
+func runFeature(args []string, stdout io.Writer, stderr io.Writer) int {
+	fs := flag.NewFlagSet("feature", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var flags loadFlags
+	flags.register(fs)
+	asJSON := fs.Bool("json", false, "print the results as JSON")
+	idsPath := fs.String("ids", "", "read IDs, one per line, from this file")
+	defaultPercentage := fs.Uint("default", 0, "percentage used when the key is missing or not an integer")
+	percentage := fs.Int64("percentage", -1, "simulate this percentage instead of the runtime value")
+	var steps featureSteps
+	fs.Var(&steps, "steps", "comma separated rollout percentages, such as 1,5,25,50,100, to report the step each ID is enabled at")
+	if err := fs.Parse(args); err != nil {
+		return exitError
+	}
+	if fs.NArg() < 3 {
+		fmt.Fprintln(stderr, "usage: goruntime feature [flags] <runtime path> <subdirectory> <key> [<id>...]")
+		fs.PrintDefaults()
+		return exitError
+	}
+
+	var ids []uint64
+	for _, arg := range fs.Args()[3:] {
+		id, err := strconv.ParseUint(arg, 10, 64)
+		if err != nil {
+			fmt.Fprintf(stderr, "goruntime: invalid ID %q\n", arg)
+			return exitError
+		}
+		ids = append(ids, id)
+	}
+	if *idsPath != "" {
+		fileIDs, err := readIDs(*idsPath)
+		if err != nil {
+			fmt.Fprintf(stderr, "goruntime: %s\n", err)
+			return exitError
+		}
+		ids = append(ids, fileIDs...)
+	}
+
+	t, err := flags.load(fs.Arg(0), fs.Arg(1))
+	if err != nil {
+		fmt.Fprintf(stderr, "goruntime: %s\n", err)
+		return exitError
+	}
+
+	r := simulateFeature(t.loader.Snapshot(), fs.Arg(2), ids, uint32(*defaultPercentage), *percentage, steps)
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(r)
+	} else {
+		r.writeText(stdout)
+	}
+
+	return t.report(stderr)
+}
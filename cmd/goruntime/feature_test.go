@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lyft/goruntime/snapshot"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeature(t *testing.T) {
+	assert := require.New(t)
+
+	dir := writeTree(t, map[string]string{
+		"app/feature/checkout": "30",
+		"app/feature/broken":   "most",
+	})
+	defer os.RemoveAll(dir)
+
+	const key = "feature.checkout"
+	// Find an ID enabled at 30% and one that is not.
+	var in, out uint64
+	for id := uint64(1); in == 0 || out == 0; id++ {
+		if snapshot.Bucket(id, key) < 30 {
+			in = id
+		} else {
+			out = id
+		}
+	}
+
+	code, stdout, stderr := runCommand("feature", dir, "app", key, fmt.Sprint(in), fmt.Sprint(out))
+	assert.Equal(exitOK, code, stderr)
+	assert.Contains(stdout, "feature.checkout at 30% (runtime value)\n")
+	assert.Regexp(fmt.Sprintf(`\n%d +true +%d +%d%%\n`, in, snapshot.Bucket(in, key), snapshot.Bucket(in, key)+1), stdout)
+	assert.Regexp(fmt.Sprintf(`\n%d +false +%d +%d%%\n`, out, snapshot.Bucket(out, key), snapshot.Bucket(out, key)+1), stdout)
+
+	idsPath := filepath.Join(dir, "ids")
+	assert.NoError(ioutil.WriteFile(idsPath, []byte(fmt.Sprintf("# ids\n%d\n\n%d\n", in, out)), 0644))
+	code, stdout, stderr = runCommand("feature", "-json", "-percentage", "100", "-steps", "100,30", "-ids", idsPath, dir, "app", key)
+	assert.Equal(exitOK, code, stderr)
+	var r featureResult
+	assert.NoError(json.Unmarshal([]byte(stdout), &r))
+	assert.Equal(uint64(100), r.Percentage)
+	assert.Equal("simulated", r.Source)
+	assert.Equal(featureSteps{30, 100}, r.Steps)
+	assert.Len(r.IDs, 2)
+	assert.True(r.IDs[0].Enabled)
+	assert.Equal(uint32(30), *r.IDs[0].EnabledAt)
+	assert.True(r.IDs[1].Enabled)
+	assert.Equal(uint32(100), *r.IDs[1].EnabledAt)
+
+	code, stdout, _ = runCommand("feature", "-default", "100", dir, "app", "feature.broken", "1")
+	assert.Equal(exitOK, code)
+	assert.Contains(stdout, `feature.broken at 100% (default, "most" is not an integer)`)
+	assert.Regexp(`\n1 +true `, stdout)
+
+	code, stdout, _ = runCommand("feature", "-steps", "1", dir, "app", "feature.missing", fmt.Sprint(out))
+	assert.Equal(exitOK, code)
+	assert.Contains(stdout, "feature.missing at 0% (default, key is not set)")
+	assert.Regexp(`false +\d+ +never\n`, stdout)
+
+	code, _, stderr = runCommand("feature", dir, "app", key, "user-1")
+	assert.Equal(exitError, code)
+	assert.Contains(stderr, `invalid ID "user-1"`)
+
+	code, _, _ = runCommand("feature", "-steps", "101", dir, "app", key)
+	assert.Equal(exitError, code)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+)
+
+type listedKey struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	// Integer is set if the value parses as an integer.
+	Integer *uint64 `json:"integer,omitempty"`
+}
+
+func runList(args []string, stdout io.Writer, stderr io.Writer) int {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var flags loadFlags
+	flags.register(fs)
+	asJSON := fs.Bool("json", false, "print keys as JSON")
+	runtimePath, subdirectory, ok := parseTreeArgs(fs, args)
+	if !ok {
+		return exitError
+	}
+
+	t, err := flags.load(runtimePath, subdirectory)
+	if err != nil {
+		fmt.Fprintf(stderr, "goruntime: %s\n", err)
+		return exitError
+	}
+
+	entries := t.loader.Snapshot().Entries()
+	keys := make([]listedKey, 0, len(entries))
+	for key, e := range entries {
+		k := listedKey{Key: key, Value: e.StringValue}
+		if e.Uint64Valid {
+			n := e.Uint64Value
+			k.Integer = &n
+		}
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Key < keys[j].Key })
+
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(keys)
+	} else {
+		tw := tabwriter.NewWriter(stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "KEY\tVALUE\tINTEGER")
+		for _, k := range keys {
+			integer := "-"
+			if k.Integer != nil {
+				integer = fmt.Sprint(*k.Integer)
+			}
+			fmt.Fprintf(tw, "%s\t%q\t%s\n", k.Key, k.Value, integer)
+		}
+		tw.Flush()
+	}
+
+	return t.report(stderr)
+}
+
+func runValidate(args []string, stdout io.Writer, stderr io.Writer) int {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var flags loadFlags
+	flags.register(fs)
+	runtimePath, subdirectory, ok := parseTreeArgs(fs, args)
+	if !ok {
+		return exitError
+	}
+
+	t, err := flags.load(runtimePath, subdirectory)
+	if err != nil {
+		fmt.Fprintf(stderr, "goruntime: %s\n", err)
+		return exitError
+	}
+
+	status := t.report(stdout)
+	if status == exitOK {
+		fmt.Fprintf(stdout, "ok: %d keys\n", len(t.loader.Snapshot().Entries()))
+	}
+	return status
+}
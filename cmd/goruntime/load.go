@@ -0,0 +1,153 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/lyft/goruntime/loader"
+	"github.com/lyft/goruntime/schema"
+	stats "github.com/lyft/gostats"
+)
+
+// loadFlags are the loader options shared by every command that loads a
+// runtime tree.
+type loadFlags struct {
+	ignoreDotfiles  bool
+	keys            string
+	stripExtension  bool
+	lowercase       bool
+	configMap       bool
+	gitRef          string
+	confine         bool
+	maxFileSize     int64
+	maxSnapshotSize int64
+	maxKeys         int
+	rejectOverLimit bool
+	schemaPath      string
+}
+
+func (f *loadFlags) register(fs *flag.FlagSet) {
+	fs.BoolVar(&f.ignoreDotfiles, "ignore-dotfiles", false, "ignore dot files and directories")
+	fs.StringVar(&f.keys, "keys", "dot", `how keys are derived from paths: "dot" or "slash"`)
+	fs.BoolVar(&f.stripExtension, "strip-extension", false, "strip file extensions from keys")
+	fs.BoolVar(&f.lowercase, "lowercase", false, "lowercase keys")
+	fs.BoolVar(&f.configMap, "configmap", false, "the runtime directory is a Kubernetes ConfigMap volume")
+	fs.StringVar(&f.gitRef, "git-ref", "", "load the tree of this git ref instead of the files on disk")
+	fs.BoolVar(&f.confine, "confine", false, "refuse files that resolve outside the runtime directory")
+	fs.Int64Var(&f.maxFileSize, "max-file-size", 0, "largest file size in bytes, 0 for no limit")
+	fs.Int64Var(&f.maxSnapshotSize, "max-snapshot-size", 0, "largest combined size of all values in bytes, 0 for no limit")
+	fs.IntVar(&f.maxKeys, "max-keys", 0, "most keys, 0 for no limit")
+	fs.BoolVar(&f.rejectOverLimit, "reject-over-limit", false, "reject the whole tree when a limit is exceeded")
+	fs.StringVar(&f.schemaPath, "schema", "", "validate values against this JSON schema file")
+}
+
+func (f *loadFlags) options() ([]loader.Option, error) {
+	// Problems are reported by the commands themselves, so the loader's own
+	// warnings would only repeat them.
+	opts := []loader.Option{loader.WithLogger(loader.NopLogger)}
+	if f.ignoreDotfiles {
+		opts = append(opts, loader.IgnoreDotFiles)
+	} else {
+		opts = append(opts, loader.AllowDotFiles)
+	}
+
+	var mappers []loader.KeyMapper
+	if f.stripExtension {
+		mappers = append(mappers, loader.StripExtension)
+	}
+	if f.lowercase {
+		mappers = append(mappers, loader.LowercaseKeys)
+	}
+	switch f.keys {
+	case "dot":
+		mappers = append(mappers, loader.DotJoinKeys)
+	case "slash":
+		mappers = append(mappers, loader.SlashKeys)
+	default:
+		return nil, fmt.Errorf("unknown key mapping %q", f.keys)
+	}
+	opts = append(opts, loader.WithKeyMapper(loader.ComposeKeyMappers(mappers...)))
+
+	if f.configMap {
+		opts = append(opts, loader.KubernetesConfigMap)
+	}
+	if f.gitRef != "" {
+		opts = append(opts, loader.GitRef(f.gitRef))
+	}
+	if f.confine {
+		opts = append(opts, loader.ConfineToRuntimeRoot)
+	}
+	if f.maxFileSize > 0 {
+		opts = append(opts, loader.MaxFileSize(f.maxFileSize))
+	}
+	if f.maxSnapshotSize > 0 {
+		opts = append(opts, loader.MaxSnapshotSize(f.maxSnapshotSize))
+	}
+	if f.maxKeys > 0 {
+		opts = append(opts, loader.MaxKeys(f.maxKeys))
+	}
+	if f.rejectOverLimit {
+		opts = append(opts, loader.OnLimitExceeded(loader.RejectOverLimit))
+	}
+	return opts, nil
+}
+
+// tree is a loaded runtime tree and the problems found loading it.
+type tree struct {
+	loader   *loader.Loader
+	problems []string
+}
+
+// load loads the runtime tree at runtimePath and subdirectory, validating it
+// against the schema if one was given. Values are validated as they are on
+// disk; the schema's policies are not applied.
+func (f *loadFlags) load(runtimePath string, subdirectory string) (*tree, error) {
+	opts, err := f.options()
+	if err != nil {
+		return nil, err
+	}
+	var s *schema.Schema
+	if f.schemaPath != "" {
+		if s, err = schema.ParseFile(f.schemaPath); err != nil {
+			return nil, err
+		}
+	}
+
+	l, err := loader.Load(runtimePath, subdirectory, stats.NewStore(stats.NewNullSink(), false), opts...)
+	status := l.Status()
+	t := &tree{loader: l, problems: status.Problems()}
+	if err != nil {
+		t.problems = append(t.problems, fmt.Sprintf("load rejected: %s", err))
+	}
+	if s != nil {
+		for _, err := range s.ValidateSnapshot(l.Snapshot()) {
+			t.problems = append(t.problems, err.Error())
+		}
+	}
+	return t, nil
+}
+
+// report prints the problems of t to w and returns the exit status.
+func (t *tree) report(w io.Writer) int {
+	for _, problem := range t.problems {
+		fmt.Fprintf(w, "problem: %s\n", problem)
+	}
+	if len(t.problems) > 0 {
+		return exitProblems
+	}
+	return exitOK
+}
+
+// parseTreeArgs parses the flags of a command taking a runtime path and subdirectory.
+func parseTreeArgs(fs *flag.FlagSet, args []string) (runtimePath string, subdirectory string, ok bool) {
+	if err := fs.Parse(args); err != nil {
+		return "", "", false
+	}
+	if fs.NArg() != 2 {
+		fmt.Fprintf(fs.Output(), "usage: goruntime %s [flags] <runtime path> <subdirectory>\n", fs.Name())
+		fs.PrintDefaults()
+		return "", "", false
+	}
+	return fs.Arg(0), fs.Arg(1), true
+}
@@ -0,0 +1,73 @@
+// Command goruntime inspects runtime trees exactly as the loader sees them,
+// for checking runtime changes before they ship.
+//
+// Usage:
+//
+//	goruntime list [flags] <runtime path> <subdirectory>
+//	goruntime validate [flags] <runtime path> <subdirectory>
+//	goruntime watch [flags] <runtime path> <subdirectory>
+//	goruntime diff [flags] <old path>[@<git ref>] <new path>[@<git ref>] <subdirectory>
+//	goruntime feature [flags] <runtime path> <subdirectory> <key> [<id>...]
+//
+// Run "goruntime <command> -h" for the flags of a command. Commands exit with
+// status 1 if they find problems, or differences for diff, and 2 if they
+// cannot run.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+const (
+	exitOK       = 0
+	exitProblems = 1
+	exitError    = 2
+)
+
+type command struct {
+	summary string
+	run     func(args []string, stdout io.Writer, stderr io.Writer) int
+}
+
+var commands = map[string]command{
+	"list":     {"print the keys and values a runtime tree produces", runList},
+	"diff":     {"compare the keys of two runtime trees or git revisions", runDiff},
+	"feature":  {"show which IDs a feature key is enabled for", runFeature},
+	"validate": {"check a runtime tree for problems", runValidate},
+	"watch":    {"print the changes a loader sees as they happen", runWatch},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout io.Writer, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return exitError
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "goruntime: unknown command %q\n", args[0])
+		usage(stderr)
+		return exitError
+	}
+	return cmd.run(args[1:], stdout, stderr)
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: goruntime <command> [flags] [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-10s %s\n", name, commands[name].summary)
+	}
+}
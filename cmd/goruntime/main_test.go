@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// writeTree creates a runtime tree under a new directory and returns it.
+func writeTree(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "goruntime_cmd_test")
+	require.NoError(t, err)
+	for name, value := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, ioutil.WriteFile(path, []byte(value), 0644))
+	}
+	return dir
+}
+
+func runCommand(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestList(t *testing.T) {
+	assert := require.New(t)
+
+	dir := writeTree(t, map[string]string{
+		"app/svc/timeout_ms": "250\n",
+		"app/svc/mode":       "fast",
+		"app/.hidden":        "1",
+	})
+	defer os.RemoveAll(dir)
+
+	code, stdout, stderr := runCommand("list", dir, "app")
+	assert.Equal(exitOK, code, stderr)
+	assert.Equal(`KEY             VALUE    INTEGER
+.hidden         "1"      1
+svc.mode        "fast"   -
+svc.timeout_ms  "250\n"  250
+`, stdout)
+
+	code, stdout, _ = runCommand("list", "-ignore-dotfiles", "-keys", "slash", "-json", dir, "app")
+	assert.Equal(exitOK, code)
+	assert.JSONEq(`[
+		{"key": "svc/mode", "value": "fast"},
+		{"key": "svc/timeout_ms", "value": "250\n", "integer": 250}
+	]`, stdout)
+}
+
+func TestValidate(t *testing.T) {
+	assert := require.New(t)
+
+	dir := writeTree(t, map[string]string{
+		"app/svc/timeout_ms": "5000",
+		"app/svc/TIMEOUT_MS": "250",
+		"schema.json": `{"keys": {
+			"svc.timeout_ms": {"type": "integer", "max": 1000},
+			"svc.region": {"required": true}
+		}}`,
+	})
+	defer os.RemoveAll(dir)
+
+	code, stdout, _ := runCommand("validate", dir, "app")
+	assert.Equal(exitOK, code)
+	assert.Equal("ok: 2 keys\n", stdout)
+
+	code, stdout, _ = runCommand("validate", "-lowercase", "-schema", filepath.Join(dir, "schema.json"), dir, "app")
+	assert.Equal(exitProblems, code)
+	assert.Contains(stdout, "problem: key svc.timeout_ms collides")
+	assert.Contains(stdout, "problem: runtime key svc.region: required key is missing")
+
+	code, stdout, _ = runCommand("validate", "-max-keys", "1", "-reject-over-limit", dir, "app")
+	assert.Equal(exitProblems, code)
+	assert.Contains(stdout, "problem: load rejected")
+
+	code, stdout, _ = runCommand("validate", dir, "missing")
+	assert.Equal(exitProblems, code)
+	assert.Contains(stdout, "no such file or directory")
+}
+
+func TestUsage(t *testing.T) {
+	assert := require.New(t)
+
+	code, _, stderr := runCommand()
+	assert.Equal(exitError, code)
+	assert.Contains(stderr, "list")
+
+	code, _, stderr = runCommand("frobnicate")
+	assert.Equal(exitError, code)
+	assert.Contains(stderr, "unknown command")
+
+	code, _, _ = runCommand("list", "only-one-argument")
+	assert.Equal(exitError, code)
+
+	code, _, stderr = runCommand("list", "-keys", "colon", "a", "b")
+	assert.Equal(exitError, code)
+	assert.Contains(stderr, "unknown key mapping")
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lyft/goruntime/loader"
+	"github.com/lyft/goruntime/schema"
+	stats "github.com/lyft/gostats"
+)
+
+// watchTimeFormat is the timestamp printed before every line of watch output.
+const watchTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// interrupted returns a channel that receives when the watch command should
+// stop, and a function releasing it. Tests replace it.
+var interrupted = func() (<-chan os.Signal, func()) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt)
+	return c, func() { signal.Stop(c) }
+}
+
+// watchWriter prefixes every line with a timestamp. It is written to by the
+// loader's watcher goroutine as well as the command, so writes are serialized.
+type watchWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (w *watchWriter) printf(format string, args ...interface{}) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := time.Now().Format(watchTimeFormat)
+	for _, line := range strings.SplitAfter(fmt.Sprintf(format, args...), "\n") {
+		if line != "" {
+			fmt.Fprintf(w.w, "%s %s", now, line)
+		}
+	}
+}
+
+// tracingRefresher prints every event seen by a refresher and whether it
+// triggered a reload.
+type tracingRefresher struct {
+	loader.WatchRefresher
+	out *watchWriter
+}
+
+func (r *tracingRefresher) Watch(runtimePath string, appDirPath string, watcher loader.PathWatcher) error {
+	if err := r.WatchRefresher.Watch(runtimePath, appDirPath, watcher); err != nil {
+		return err
+	}
+	r.out.printf("watching %s\n", strings.Join(watcher.Paths(), ", "))
+	return nil
+}
+
+func (r *tracingRefresher) ShouldRefresh(path string, op loader.FileSystemOp) bool {
+	refresh := r.WatchRefresher.ShouldRefresh(path, op)
+	if refresh {
+		r.out.printf("event: %s %s: reloading\n", op, path)
+	} else {
+		r.out.printf("event: %s %s: ignored\n", op, path)
+	}
+	return refresh
+}
+
+func (r *tracingRefresher) WatchError(err error) {
+	r.out.printf("watch error: %s\n", err)
+	r.WatchRefresher.WatchError(err)
+}
+
+func newRefresher(name string, runtimePath string) (loader.WatchRefresher, error) {
+	switch name {
+	case "directory":
+		return loader.AdaptRefresher(&loader.DirectoryRefresher{}), nil
+	case "symlink":
+		return loader.AdaptRefresher(&loader.SymlinkRefresher{RuntimePath: runtimePath}), nil
+	case "symlink-chain":
+		return &loader.SymlinkChainRefresher{RuntimePath: runtimePath}, nil
+	case "configmap":
+		return loader.AdaptRefresher(&loader.ConfigMapRefresher{}), nil
+	}
+	return nil, fmt.Errorf("unknown refresher %q", name)
+}
+
+// statusKey identifies the outcome of a reload, so each outcome is only
+// printed once.
+func statusKey(status loader.Status) string {
+	key := strings.Join(status.Problems(), "\n")
+	if status.LastError != nil {
+		key += "\n" + status.LastError.Error()
+	}
+	return key
+}
+
+func printStatus(out *watchWriter, status loader.Status) {
+	if status.LastError != nil {
+		out.printf("load failed, keeping the previous snapshot: %s\n", status.LastError)
+	}
+	for _, problem := range status.Problems() {
+		out.printf("problem: %s\n", problem)
+	}
+}
+
+func runWatch(args []string, stdout io.Writer, stderr io.Writer) int {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var flags loadFlags
+	flags.register(fs)
+	refresherName := fs.String("refresher", "directory", `how changes are detected: "directory", "symlink", "symlink-chain" or "configmap"`)
+	trace := fs.Bool("trace", false, "print every filesystem event and whether the refresher reloaded for it")
+	poll := fs.Duration("poll", 250*time.Millisecond, "how often to check for rejected reloads, which publish no snapshot")
+	var features stringList
+	fs.Var(&features, "features", "key prefix of feature percentage keys, may be repeated; all keys if unset")
+	runtimePath, subdirectory, ok := parseTreeArgs(fs, args)
+	if !ok {
+		return exitError
+	}
+
+	opts, err := flags.options()
+	if err == nil && flags.schemaPath != "" {
+		var s *schema.Schema
+		if s, err = schema.ParseFile(flags.schemaPath); err == nil {
+			opts = append(opts, loader.WithSchema(s))
+		}
+	}
+	var refresher loader.WatchRefresher
+	if err == nil {
+		refresher, err = newRefresher(*refresherName, runtimePath)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "goruntime: %s\n", err)
+		return exitError
+	}
+
+	out := &watchWriter{w: stdout}
+	if *trace {
+		refresher = &tracingRefresher{WatchRefresher: refresher, out: out}
+	}
+	stop, release := interrupted()
+	defer release()
+
+	l, err := loader.NewFromWatchRefresher(runtimePath, subdirectory, stats.NewStore(stats.NewNullSink(), false), refresher, opts...)
+	if err != nil {
+		fmt.Fprintf(stderr, "goruntime: %s\n", err)
+		return exitError
+	}
+	ldr, ok := l.(*loader.Loader)
+	if !ok {
+		fmt.Fprintln(stderr, "goruntime: a runtime path and subdirectory are required")
+		return exitError
+	}
+	defer ldr.Close()
+	updates := make(chan int, 1)
+	ldr.AddUpdateCallback(updates)
+
+	current := ldr.Snapshot()
+	status := ldr.Status()
+	out.printf("loaded %d keys\n", len(current.Entries()))
+	printStatus(out, status)
+	lastStatus := statusKey(status)
+
+	ticker := time.NewTicker(*poll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return exitOK
+		case <-updates:
+			next := ldr.Snapshot()
+			if next == current {
+				continue
+			}
+			if d := diffSnapshots(current, next, features); d.empty() {
+				out.printf("new snapshot, no keys changed\n")
+			} else {
+				var text strings.Builder
+				d.writeText(&text)
+				out.printf("new snapshot:\n%s", text.String())
+			}
+			current = next
+		case <-ticker.C:
+		}
+
+		// Rejected reloads publish no snapshot and signal no callback, so
+		// their status is checked on every tick.
+		if status := ldr.Status(); statusKey(status) != lastStatus {
+			if lastStatus = statusKey(status); lastStatus == "" {
+				out.printf("loaded without problems\n")
+			}
+			printStatus(out, status)
+		}
+	}
+}
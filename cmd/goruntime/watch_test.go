@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// syncBuffer is a bytes.Buffer that can be read while the command writes to it.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestWatch(t *testing.T) {
+	assert := require.New(t)
+
+	dir := writeTree(t, map[string]string{"app/timeout_ms": "250"})
+	defer os.RemoveAll(dir)
+
+	stop := make(chan os.Signal)
+	defer func(original func() (<-chan os.Signal, func())) { interrupted = original }(interrupted)
+	interrupted = func() (<-chan os.Signal, func()) { return stop, func() {} }
+
+	var stdout, stderr syncBuffer
+	done := make(chan int)
+	go func() {
+		done <- run([]string{"watch", "-trace", "-poll", "10ms", "-max-file-size", "8", dir, "app"}, &stdout, &stderr)
+	}()
+
+	waitFor := func(s string) {
+		deadline := time.Now().Add(5 * time.Second)
+		for !strings.Contains(stdout.String(), s) {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %q in:\n%s", s, stdout.String())
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	waitFor("loaded 1 keys\n")
+	assert.NoError(ioutil.WriteFile(filepath.Join(dir, "app/timeout_ms"), []byte("500"), 0644))
+	waitFor(`~ timeout_ms: "250" -> "500"`)
+	waitFor("event: write " + filepath.Join(dir, "app/timeout_ms") + ": reloading\n")
+
+	assert.NoError(ioutil.WriteFile(filepath.Join(dir, "app/too_big"), []byte("0123456789"), 0644))
+	waitFor("problem: runtime: " + filepath.Join(dir, "app/too_big") + " exceeds the file_size limit of 8\n")
+
+	close(stop)
+	assert.Equal(exitOK, <-done, stderr.String())
+
+	for _, line := range strings.Split(strings.TrimSpace(stdout.String()), "\n") {
+		_, err := time.Parse(watchTimeFormat, strings.SplitN(line, " ", 2)[0])
+		assert.NoError(err, line)
+	}
+}
+
+func TestWatchUnknownRefresher(t *testing.T) {
+	dir := writeTree(t, map[string]string{"app/key": "1"})
+	defer os.RemoveAll(dir)
+
+	code, _, stderr := runCommand("watch", "-refresher", "inotify", dir, "app")
+	require.Equal(t, exitError, code)
+	require.Contains(t, stderr, `unknown refresher "inotify"`)
+}
@@ -3,10 +3,14 @@ module github.com/lyft/goruntime
 go 1.14
 
 require (
+	github.com/envoyproxy/go-control-plane v0.9.9
 	github.com/fsnotify/fsnotify v1.4.9
 	github.com/kelseyhightower/envconfig v1.4.0 // indirect
 	github.com/lyft/gostats v0.4.1
 	github.com/sirupsen/logrus v1.6.0
-	github.com/stretchr/testify v1.2.2
+	github.com/stretchr/testify v1.5.1
 	golang.org/x/sys v0.0.0-20200523222454-059865788121 // indirect
+	google.golang.org/genproto v0.0.0-20200526211855-cb27e3aa2013
+	google.golang.org/grpc v1.36.0
+	google.golang.org/protobuf v1.25.0
 )
@@ -0,0 +1,33 @@
+package loader
+
+import "path/filepath"
+
+// configMapDataDir is the symlink the Kubernetes atomic writer swaps to
+// publish a new version of a ConfigMap or Secret volume.
+const configMapDataDir = "..data"
+
+// ConfigMapRefresher watches a Kubernetes ConfigMap or Secret volume mounted
+// at the runtime directory. The kubelet publishes every update by atomically
+// renaming a new "..data" symlink into place, so the runtime is refreshed
+// exactly once per update, when that rename lands. Use it together with the
+// KubernetesConfigMap option.
+type ConfigMapRefresher struct {
+	dataPath string
+}
+
+func (c *ConfigMapRefresher) WatchDirectory(runtimePath string, appDirPath string) string {
+	dir := filepath.Join(runtimePath, appDirPath)
+	c.dataPath = filepath.Join(dir, configMapDataDir)
+	return dir
+}
+
+func (c *ConfigMapRefresher) ShouldRefresh(path string, op FileSystemOp) bool {
+	// Renaming ..data_tmp over ..data is reported as a Create of ..data.
+	return path == c.dataPath && op == Create
+}
+
+// KubernetesConfigMap reads the runtime directory as a Kubernetes ConfigMap or
+// Secret volume: only the keys projected into the current "..data" directory
+// are loaded, rather than the timestamped directories and per-key symlinks
+// the atomic writer keeps alongside it.
+func KubernetesConfigMap(l *Loader) { l.configMapLayout = true }
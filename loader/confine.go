@@ -0,0 +1,84 @@
+package loader
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// PathViolation is a runtime file that resolved to a path outside the
+// runtime root and allowlist while the loader was confined.
+type PathViolation struct {
+	Path string
+	// Target is what Path resolved to.
+	Target string
+}
+
+// ConfineToRuntimeRoot resolves every runtime file, following symlinks, and
+// refuses to read files that resolve outside the runtime directory, so a
+// symlink in a runtime deploy cannot expose arbitrary host files. Refused
+// files are logged, counted in the path_violations stat and listed in the
+// loader's Status.
+func ConfineToRuntimeRoot(l *Loader) { l.confineToRoot = true }
+
+// AllowPaths confines the loader like ConfineToRuntimeRoot, additionally
+// allowing files that resolve inside any of paths.
+func AllowPaths(paths ...string) Option {
+	return func(l *Loader) {
+		l.confineToRoot = true
+		l.allowedPaths = append(l.allowedPaths, paths...)
+	}
+}
+
+// resolveAllowedRoots resolves the runtime root and allowlist for the walk
+// about to start. Paths that cannot be resolved allow nothing.
+func (s *fileSource) resolveAllowedRoots() {
+	s.allowedRoots = s.allowedRoots[:0]
+	for _, path := range append([]string{s.root}, s.loader.allowedPaths...) {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			resolved, err = filepath.Abs(resolved)
+		}
+		if err != nil {
+			s.loader.log().Warn("runtime: error resolving allowed path", pathField(path), errorField(err))
+			continue
+		}
+		s.allowedRoots = append(s.allowedRoots, resolved)
+	}
+}
+
+// confine resolves path and returns the target to read, or false if path
+// may not be read.
+func (s *fileSource) confine(path string) (string, bool) {
+	l := s.loader
+
+	target, err := filepath.EvalSymlinks(path)
+	if err == nil {
+		target, err = filepath.Abs(target)
+	}
+	if err != nil {
+		l.stats.loadFailures.Inc()
+		l.stats.pathErrors.Inc()
+		l.log().Warn("runtime: error resolving path", pathField(path), errorField(err))
+		l.pending.FileErrors = append(l.pending.FileErrors, FileError{Path: path, Err: err})
+		return "", false
+	}
+
+	for _, root := range s.allowedRoots {
+		if isWithin(root, target) {
+			return target, true
+		}
+	}
+
+	l.stats.pathViolations.Inc()
+	l.pending.PathViolations = append(l.pending.PathViolations, PathViolation{Path: path, Target: target})
+	l.log().Warn("runtime: refusing to read a file that resolves outside the runtime root", pathField(path), targetField(target))
+	return "", false
+}
+
+func isWithin(root string, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,79 @@
+package loader
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	stats "github.com/lyft/gostats"
+	"github.com/lyft/gostats/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfineToRuntimeRoot(t *testing.T) {
+	assert := require.New(t)
+
+	tempDir, err := ioutil.TempDir("", "confine_test")
+	assert.NoError(err)
+	defer os.RemoveAll(tempDir)
+	tempDir, err = filepath.EvalSymlinks(tempDir)
+	assert.NoError(err)
+
+	// The runtime root is itself reached through a symlink, as in symlink deploys.
+	makeFileInDir(assert, tempDir+"/v1/app/file1", "hello")
+	makeFileInDir(assert, tempDir+"/v1/app/shared/file2", "42")
+	makeFileInDir(assert, tempDir+"/secret/key", "hunter2")
+	makeFileInDir(assert, tempDir+"/allowed/value", "7")
+	assert.NoError(os.Symlink(tempDir+"/v1", tempDir+"/current"))
+	assert.NoError(os.Symlink("file1", tempDir+"/v1/app/inside"))
+	assert.NoError(os.Symlink("../../secret/key", tempDir+"/v1/app/escape"))
+	assert.NoError(os.Symlink(tempDir+"/allowed/value", tempDir+"/v1/app/extra"))
+
+	sink := mock.NewSink()
+	store := stats.NewStore(sink, false)
+	loader, err := New2(tempDir+"/current", "app", store.Scope("runtime"), &SymlinkRefresher{RuntimePath: tempDir + "/current"}, ConfineToRuntimeRoot)
+	assert.NoError(err)
+	defer loader.(*Loader).Close()
+
+	snapshot := loader.Snapshot()
+	keys := snapshot.Keys()
+	sort.Strings(keys)
+	assert.Equal([]string{"file1", "inside", "shared.file2"}, keys)
+	assert.Equal("hello", snapshot.Get("inside"))
+
+	violations := loader.(*Loader).Status().PathViolations
+	sort.Slice(violations, func(i, j int) bool { return violations[i].Path < violations[j].Path })
+	assert.Equal([]PathViolation{
+		{Path: tempDir + "/current/app/escape", Target: tempDir + "/secret/key"},
+		{Path: tempDir + "/current/app/extra", Target: tempDir + "/allowed/value"},
+	}, violations)
+
+	store.Flush()
+	sink.AssertCounterEquals(t, "runtime.path_violations", 2)
+
+	loader, err = New2(tempDir+"/current", "app", nullScope, &SymlinkRefresher{RuntimePath: tempDir + "/current"}, AllowPaths(tempDir+"/allowed"))
+	assert.NoError(err)
+	defer loader.(*Loader).Close()
+	assert.Equal(uint64(7), loader.Snapshot().GetInteger("extra", 0))
+	assert.Equal("", loader.Snapshot().Get("escape"))
+	assert.Len(loader.(*Loader).Status().PathViolations, 1)
+
+	// Without confinement symlinks are followed anywhere.
+	loader, err = New2(tempDir+"/current", "app", nullScope, &SymlinkRefresher{RuntimePath: tempDir + "/current"})
+	assert.NoError(err)
+	defer loader.(*Loader).Close()
+	assert.Equal("hunter2", loader.Snapshot().Get("escape"))
+}
+
+func TestIsWithin(t *testing.T) {
+	assert := require.New(t)
+
+	assert.True(isWithin("/runtime", "/runtime"))
+	assert.True(isWithin("/runtime", "/runtime/a/b"))
+	assert.True(isWithin("/runtime", "/runtime/..a"))
+	assert.False(isWithin("/runtime", "/runtime2/a"))
+	assert.False(isWithin("/runtime", "/etc/passwd"))
+	assert.False(isWithin("/runtime/app", "/runtime"))
+}
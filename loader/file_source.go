@@ -0,0 +1,323 @@
+package loader
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/lyft/goruntime/snapshot/entry"
+)
+
+// fileSource is the Source behind loaders created with New2. It walks the
+// runtime directory on disk, or a pinned git tree, and watches the filesystem
+// for changes the WatchRefresher cares about. Keys reads every file, and Get
+// parses the contents read into entries.
+type fileSource struct {
+	loader    *Loader
+	watcher   *pathWatcher
+	refresher WatchRefresher
+	// values are the contents read for each key in the current walk.
+	values map[string]fileValue
+	// metadata is recorded in the snapshot built from the current walk.
+	metadata map[string]string
+	// root is the directory keys are relative to in the current walk.
+	root string
+	// paths maps each key in values to the file it was read from.
+	paths map[string]string
+	// size is the combined size of values.
+	size int64
+	// allowedRoots are the resolved directories files may be read from when
+	// the loader is confined.
+	allowedRoots []string
+
+	// gitRefPaths are the files that decide what the pinned ref resolves to,
+	// guarded by gitMu. Changes to them reload the runtime.
+	gitMu       sync.Mutex
+	gitRefPaths map[string]bool
+}
+
+// fileValue is the contents of a runtime file, not yet parsed into an entry.
+type fileValue struct {
+	contents string
+	modified time.Time
+}
+
+// pathWatcher is the PathWatcher handed to refreshers, backed by fsnotify.
+type pathWatcher struct {
+	*fsnotify.Watcher
+
+	mu    sync.Mutex
+	paths map[string]bool
+}
+
+func newPathWatcher(watcher *fsnotify.Watcher) *pathWatcher {
+	return &pathWatcher{Watcher: watcher, paths: map[string]bool{}}
+}
+
+func (w *pathWatcher) Add(path string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.paths[path] {
+		return nil
+	}
+	if err := w.Watcher.Add(path); err != nil {
+		return fmt.Errorf("unable to watch file (%[1]s): %[2]s (%[2]T %#[2]v)", path, err)
+	}
+	w.paths[path] = true
+	return nil
+}
+
+func (w *pathWatcher) Remove(path string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.paths[path] {
+		return nil
+	}
+	delete(w.paths, path)
+	return w.Watcher.Remove(path)
+}
+
+// watches reports whether path is being watched.
+func (w *pathWatcher) watches(path string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.paths[path]
+}
+
+// forget stops watching path after it was removed or renamed. The kernel may
+// already have dropped the watch, so errors are ignored.
+func (w *pathWatcher) forget(path string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	delete(w.paths, path)
+	w.Watcher.Remove(path)
+}
+
+func (w *pathWatcher) Paths() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	paths := make([]string, 0, len(w.paths))
+	for path := range w.paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func (s *fileSource) Keys() ([]string, error) {
+	l := s.loader
+	s.values = map[string]fileValue{}
+	s.metadata = map[string]string{}
+	s.paths = map[string]string{}
+	s.size = 0
+
+	if l.gitRef != "" {
+		if err := s.loadGitRef(); err != nil {
+			return nil, err
+		}
+	} else {
+		s.root = filepath.Join(l.watchPath, l.subdirectory)
+		if !l.configMapLayout || s.resolveConfigMapRoot() {
+			if l.confineToRoot {
+				s.resolveAllowedRoots()
+			}
+			if err := filepath.Walk(s.root, s.walkDirectoryCallback); err != nil {
+				return nil, err
+			}
+		}
+		if l.trackGitRevision {
+			s.recordGitRevision()
+		}
+	}
+
+	keys := make([]string, 0, len(s.values))
+	for key := range s.values {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (s *fileSource) Get(key string) (*entry.Entry, error) {
+	v, ok := s.values[key]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return entry.New(v.contents, v.modified), nil
+}
+
+func (s *fileSource) Metadata() map[string]string {
+	return s.metadata
+}
+
+func (s *fileSource) Watch(stop <-chan struct{}, changed func()) error {
+	if s.watcher == nil {
+		return errors.New("goruntime/loader: no filesystem watcher")
+	}
+
+	rewatch := newRewatcher(s.watcher)
+	defer rewatch.stop()
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case ev, ok := <-s.watcher.Events:
+			if !ok {
+				// The watcher was closed by Close.
+				return nil
+			}
+			op := getFileSystemOp(ev)
+			if (op == Remove || op == Rename) && s.watcher.watches(ev.Name) {
+				// The watch died with the path, so nothing more would be seen
+				// until the path is watched again.
+				s.loader.log().Warn("runtime: watched path was removed, watching again once it reappears", pathField(ev.Name), opField(op))
+				rewatch.lose(ev.Name)
+			}
+			if s.refresher.ShouldRefresh(ev.Name, op) || s.isGitRefPath(ev.Name) {
+				s.loader.log().Debug("runtime: reloading after filesystem event", pathField(ev.Name), opField(op))
+				changed()
+			}
+		case err, ok := <-s.watcher.Errors:
+			if !ok {
+				return nil
+			}
+			s.loader.stats.watchErrors.Inc()
+			s.loader.log().Warn("runtime: filesystem watch error", errorField(err))
+			s.refresher.WatchError(err)
+		case <-rewatch.C():
+			if recovered := rewatch.retry(); len(recovered) > 0 {
+				for _, path := range recovered {
+					s.loader.stats.watchRecoveries.Inc()
+					s.loader.log().Info("runtime: watching path again", pathField(path))
+				}
+				// Whatever changed while the path was gone was missed.
+				changed()
+			}
+		}
+	}
+}
+
+// resolveConfigMapRoot points the walk at the directory "..data" currently
+// links to, so keys are relative to it and only projected keys are seen.
+// It reports whether there is anything to walk.
+func (s *fileSource) resolveConfigMapRoot() bool {
+	dataDir, err := filepath.EvalSymlinks(filepath.Join(s.root, configMapDataDir))
+	if err != nil {
+		s.loader.stats.loadFailures.Inc()
+		s.loader.stats.pathErrors.Inc()
+		s.loader.log().Warn("runtime: error resolving ConfigMap data", pathField(s.root), errorField(err))
+		s.loader.pending.FileErrors = append(s.loader.pending.FileErrors, FileError{Path: s.root, Err: err})
+		return false
+	}
+	s.root = dataDir
+	return true
+}
+
+// setValue sets the value of key to v, read from path. If an earlier file
+// already mapped to key, the collision is counted and reported and v replaces
+// the earlier value: the last file walked wins.
+func (s *fileSource) setValue(path string, key string, v fileValue) {
+	if previous, ok := s.paths[key]; ok {
+		s.loader.stats.keyCollisions.Inc()
+		s.loader.log().Warn("runtime: files map to the same key, loading the later one",
+			keyField(key), pathField(path), Field{Key: "replaced_path", Value: previous})
+		s.loader.pending.addCollision(key, previous, path)
+		s.size -= int64(len(s.values[key].contents))
+	}
+	s.paths[key] = path
+	s.size += int64(len(v.contents))
+	s.values[key] = v
+}
+
+func (s *fileSource) walkDirectoryCallback(path string, info os.FileInfo, err error) error {
+	l := s.loader
+
+	if err != nil {
+		l.stats.loadFailures.Inc()
+		l.stats.readError(err).Inc()
+		l.log().Warn("runtime: error processing file", pathField(path), errorField(err))
+		l.pending.FileErrors = append(l.pending.FileErrors, FileError{Path: path, Err: err})
+
+		return nil
+	}
+
+	if l.ignoreDotfiles && info.IsDir() && strings.HasPrefix(info.Name(), ".") {
+		return filepath.SkipDir
+	}
+
+	if !info.IsDir() {
+		if l.ignoreDotfiles && strings.HasPrefix(info.Name(), ".") {
+			return nil
+		}
+
+		readPath := path
+		if l.confineToRoot {
+			target, ok := s.confine(path)
+			if !ok {
+				return nil
+			}
+			// Read the checked target rather than following the links again.
+			readPath = target
+		}
+
+		contents, violation, err := s.readFile(readPath)
+
+		if err != nil {
+			l.stats.loadFailures.Inc()
+			l.stats.readError(err).Inc()
+			l.log().Warn("runtime: error reading file", pathField(path), errorField(err))
+			l.pending.FileErrors = append(l.pending.FileErrors, FileError{Path: path, Err: err})
+
+			return nil
+		}
+
+		key, err := filepath.Rel(s.root, path)
+
+		if err != nil {
+			l.stats.loadFailures.Inc()
+			l.stats.parseErrors.Inc()
+			l.log().Warn("runtime: error parsing path", pathField(path), errorField(err))
+			l.pending.FileErrors = append(l.pending.FileErrors, FileError{Path: path, Err: err})
+
+			return nil
+		}
+
+		key = l.mapKey(filepath.ToSlash(key))
+		if violation == nil {
+			violation = s.checkLimits(path, key, int64(len(contents)))
+		}
+		if violation != nil {
+			return s.limitExceeded(violation)
+		}
+
+		s.setValue(path, key, fileValue{contents: string(contents), modified: info.ModTime()})
+	}
+
+	return nil
+}
+
+func getFileSystemOp(ev fsnotify.Event) FileSystemOp {
+	switch ev.Op {
+	case ev.Op & fsnotify.Write:
+		return Write
+	case ev.Op & fsnotify.Create:
+		return Create
+	case ev.Op & fsnotify.Chmod:
+		return Chmod
+	case ev.Op & fsnotify.Remove:
+		return Remove
+	case ev.Op & fsnotify.Rename:
+		return Rename
+	}
+	return -1
+}
@@ -0,0 +1,163 @@
+package loader
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lyft/goruntime/loader/git"
+	stats "github.com/lyft/gostats"
+)
+
+// Snapshot metadata keys recorded by TrackGitRevision and GitRef.
+const (
+	GitCommitMetadataKey     = "git.commit"
+	GitCommitTimeMetadataKey = "git.commit_time"
+	GitRefMetadataKey        = "git.ref"
+)
+
+// TrackGitRevision records the commit checked out in the git working tree that
+// contains the runtime path, and its commit time, in every snapshot's metadata.
+func TrackGitRevision(l *Loader) { l.trackGitRevision = true }
+
+// GitRef builds snapshots from the tree of ref in the local git object store of
+// the working tree containing the runtime path, instead of from the files on
+// disk. ref may be a commit hash, branch, tag or "HEAD". Nothing is fetched:
+// ref must already exist locally. Entries are stamped with the commit time.
+func GitRef(ref string) Option {
+	return func(l *Loader) { l.gitRef = ref }
+}
+
+func (s *fileSource) recordGitRevision() {
+	l := s.loader
+	repo, err := git.Open(l.watchPath)
+	if err != nil {
+		l.log().Warn("runtime: error opening git repository", pathField(l.watchPath), errorField(err))
+		return
+	}
+	commit, err := repo.Head()
+	if err != nil {
+		l.log().Warn("runtime: error reading git HEAD", pathField(l.watchPath), errorField(err))
+		return
+	}
+	setGitMetadata(s.metadata, commit)
+}
+
+// gitRefError fails a reload that cannot load the tree of the pinned ref, so
+// that the previous snapshot is kept. class is the stat it is counted in.
+type gitRefError struct {
+	op    string
+	err   error
+	class stats.Counter
+}
+
+func (e *gitRefError) Error() string { return e.op + ": " + e.err.Error() }
+
+func (e *gitRefError) Unwrap() error { return e.err }
+
+// loadGitRef fills the snapshot being built from the tree of the pinned ref.
+// Failing to open the repository, resolve the ref or walk its tree fails the
+// reload; files that cannot be read are logged and skipped.
+func (s *fileSource) loadGitRef() error {
+	l := s.loader
+	repo, err := git.Open(l.watchPath)
+	if err != nil {
+		return &gitRefError{op: "opening git repository", err: err, class: l.stats.readError(err)}
+	}
+	s.watchGitRef(repo)
+	commit, err := repo.ResolveCommit(l.gitRef)
+	if err != nil {
+		return &gitRefError{op: "resolving git ref", err: err, class: l.stats.parseErrors}
+	}
+
+	root, err := filepath.EvalSymlinks(l.watchPath)
+	if err == nil {
+		root, err = filepath.Abs(root)
+	}
+	if err == nil {
+		root, err = filepath.Rel(repo.WorkTree, root)
+	}
+	if err != nil {
+		return &gitRefError{op: "locating path in git working tree", err: err, class: l.stats.pathErrors}
+	}
+	dir := path.Join(filepath.ToSlash(root), filepath.ToSlash(l.subdirectory))
+
+	err = repo.Walk(commit, dir, func(p string, mode git.Mode, object git.Hash) error {
+		name := path.Base(p)
+		if mode == git.ModeDir {
+			if l.ignoreDotfiles && strings.HasPrefix(name, ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// Symlinks and submodules have no contents of their own in the tree.
+		if !mode.IsRegular() || (l.ignoreDotfiles && strings.HasPrefix(name, ".")) {
+			return nil
+		}
+
+		// Limits are checked against the size in the object header, so an
+		// oversized blob is never inflated.
+		size, err := repo.BlobSize(object)
+		if err != nil {
+			l.stats.loadFailures.Inc()
+			l.stats.readError(err).Inc()
+			l.log().Warn("runtime: error reading file", pathField(p), refField(l.gitRef), errorField(err))
+			return nil
+		}
+		key := l.mapKey(p)
+		if violation := s.checkLimits(path.Join(dir, p), key, size); violation != nil {
+			return s.limitExceeded(violation)
+		}
+		contents, err := repo.ReadBlob(object)
+		if err != nil {
+			l.stats.loadFailures.Inc()
+			l.stats.readError(err).Inc()
+			l.log().Warn("runtime: error reading file", pathField(p), refField(l.gitRef), errorField(err))
+			return nil
+		}
+		s.setValue(path.Join(dir, p), key, fileValue{contents: string(contents), modified: commit.CommitTime})
+		return nil
+	})
+	if _, ok := err.(*LimitViolation); ok {
+		return err
+	}
+	if err != nil {
+		return &gitRefError{op: "walking git tree", err: err, class: l.stats.readError(err)}
+	}
+
+	s.metadata[GitRefMetadataKey] = l.gitRef
+	setGitMetadata(s.metadata, commit)
+	return nil
+}
+
+// watchGitRef watches the files that decide what the pinned ref resolves to,
+// so that moving the ref reloads the runtime although no runtime file changed.
+// Git replaces them by renaming lock files, so their directories are watched.
+func (s *fileSource) watchGitRef(repo *git.Repository) {
+	paths := map[string]bool{}
+	for _, p := range repo.RefPaths(s.loader.gitRef) {
+		paths[p] = true
+		if s.watcher != nil {
+			// Directories that do not exist, such as refs/remotes in a fresh
+			// clone, cannot be watched; refs are rarely created there later.
+			s.watcher.Add(filepath.Dir(p))
+		}
+	}
+
+	s.gitMu.Lock()
+	defer s.gitMu.Unlock()
+	s.gitRefPaths = paths
+}
+
+// isGitRefPath reports whether path decides what the pinned ref resolves to.
+func (s *fileSource) isGitRefPath(path string) bool {
+	s.gitMu.Lock()
+	defer s.gitMu.Unlock()
+	return s.gitRefPaths[path]
+}
+
+func setGitMetadata(metadata map[string]string, commit *git.Commit) {
+	metadata[GitCommitMetadataKey] = commit.Hash.String()
+	metadata[GitCommitTimeMetadataKey] = commit.CommitTime.Format(time.RFC3339)
+}
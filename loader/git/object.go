@@ -0,0 +1,200 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+type objectType int
+
+const (
+	objectCommit objectType = 1
+	objectTree   objectType = 2
+	objectBlob   objectType = 3
+	objectTag    objectType = 4
+)
+
+func (t objectType) String() string {
+	switch t {
+	case objectCommit:
+		return "commit"
+	case objectTree:
+		return "tree"
+	case objectBlob:
+		return "blob"
+	case objectTag:
+		return "tag"
+	}
+	return "object(" + strconv.Itoa(int(t)) + ")"
+}
+
+func parseObjectType(name string) (objectType, error) {
+	switch name {
+	case "commit":
+		return objectCommit, nil
+	case "tree":
+		return objectTree, nil
+	case "blob":
+		return objectBlob, nil
+	case "tag":
+		return objectTag, nil
+	}
+	return 0, fmt.Errorf("goruntime/git: unknown object type %q", name)
+}
+
+// readObject returns the type and contents of the object named h, looking in
+// the loose object store first and then in every pack.
+func (r *Repository) readObject(h Hash) (objectType, []byte, error) {
+	kind, data, err := r.readLooseObject(h)
+	if err == nil || !os.IsNotExist(err) {
+		return kind, data, err
+	}
+
+	packs, err := r.loadPacks()
+	if err != nil {
+		return 0, nil, err
+	}
+	for _, p := range packs {
+		offset, ok := p.find(h)
+		if !ok {
+			continue
+		}
+		return p.readAt(r, offset)
+	}
+
+	// The object may have been packed since the packs were listed.
+	r.mu.Lock()
+	r.packs = nil
+	r.mu.Unlock()
+
+	return 0, nil, fmt.Errorf("goruntime/git: object %s not found", h)
+}
+
+// objectSize returns the type and size of the object named h, reading only
+// its header rather than inflating its contents.
+func (r *Repository) objectSize(h Hash) (objectType, int64, error) {
+	kind, size, err := r.readLooseHeader(h)
+	if err == nil || !os.IsNotExist(err) {
+		return kind, size, err
+	}
+
+	packs, err := r.loadPacks()
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, p := range packs {
+		if offset, ok := p.find(h); ok {
+			return p.sizeAt(r, offset)
+		}
+	}
+
+	r.mu.Lock()
+	r.packs = nil
+	r.mu.Unlock()
+
+	return 0, 0, fmt.Errorf("goruntime/git: object %s not found", h)
+}
+
+// openLooseObject opens the loose object named h, returning a reader of its
+// inflated contents positioned after the header, and its type and size.
+func (r *Repository) openLooseObject(h Hash) (io.ReadCloser, objectType, int64, error) {
+	name := h.String()
+	f, err := os.Open(filepath.Join(r.commonDir, "objects", name[:2], name[2:]))
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	zr, err := zlib.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, 0, 0, fmt.Errorf("goruntime/git: object %s: %s", h, err)
+	}
+	obj := &looseObject{Reader: bufio.NewReader(zr), zr: zr, f: f}
+
+	// Loose objects are "<type> <size>\x00<contents>".
+	header, err := obj.ReadSlice(0)
+	space := bytes.IndexByte(header, ' ')
+	if err != nil || space < 0 {
+		obj.Close()
+		return nil, 0, 0, fmt.Errorf("goruntime/git: object %s: malformed header", h)
+	}
+	kind, err := parseObjectType(string(header[:space]))
+	if err != nil {
+		obj.Close()
+		return nil, 0, 0, err
+	}
+	size, err := strconv.ParseInt(string(header[space+1:len(header)-1]), 10, 64)
+	if err != nil || size < 0 {
+		obj.Close()
+		return nil, 0, 0, fmt.Errorf("goruntime/git: object %s: malformed header", h)
+	}
+	return obj, kind, size, nil
+}
+
+type looseObject struct {
+	*bufio.Reader
+	zr io.Closer
+	f  *os.File
+}
+
+func (o *looseObject) Close() error {
+	o.zr.Close()
+	return o.f.Close()
+}
+
+func (r *Repository) readLooseHeader(h Hash) (objectType, int64, error) {
+	obj, kind, size, err := r.openLooseObject(h)
+	if err != nil {
+		return 0, 0, err
+	}
+	obj.Close()
+	return kind, size, nil
+}
+
+func (r *Repository) readLooseObject(h Hash) (objectType, []byte, error) {
+	obj, kind, size, err := r.openLooseObject(h)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer obj.Close()
+
+	data, err := ioutil.ReadAll(obj)
+	if err != nil {
+		return 0, nil, fmt.Errorf("goruntime/git: object %s: %s", h, err)
+	}
+	if int64(len(data)) != size {
+		return 0, nil, fmt.Errorf("goruntime/git: object %s: size mismatch", h)
+	}
+	return kind, data, nil
+}
+
+func (r *Repository) loadPacks() ([]*pack, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.packs != nil {
+		return r.packs, nil
+	}
+
+	indexes, err := filepath.Glob(filepath.Join(r.commonDir, "objects", "pack", "*.idx"))
+	if err != nil {
+		return nil, err
+	}
+	packs := make([]*pack, 0, len(indexes))
+	for _, idx := range indexes {
+		p, err := openPack(idx)
+		if err != nil {
+			return nil, err
+		}
+		packs = append(packs, p)
+	}
+	r.packs = packs
+	return packs, nil
+}
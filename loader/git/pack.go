@@ -0,0 +1,365 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	packOfsDelta = 6
+	packRefDelta = 7
+
+	// maxDeltaChain guards against corrupt packs whose deltas loop.
+	maxDeltaChain = 10000
+)
+
+var errMalformedPack = errors.New("goruntime/git: malformed pack")
+
+// pack is a version 2 pack index together with the path of its pack file.
+type pack struct {
+	path    string
+	names   []Hash
+	offsets []int64
+}
+
+func openPack(indexPath string) (*pack, error) {
+	idx, err := ioutil.ReadFile(indexPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(idx) < 8+256*4 || !bytes.Equal(idx[:4], []byte("\377tOc")) || binary.BigEndian.Uint32(idx[4:8]) != 2 {
+		return nil, fmt.Errorf("goruntime/git: unsupported pack index %s", indexPath)
+	}
+
+	count := int(binary.BigEndian.Uint32(idx[8+255*4:]))
+	namesStart := 8 + 256*4
+	offsetsStart := namesStart + count*20 + count*4
+	largeStart := offsetsStart + count*4
+	if len(idx) < largeStart {
+		return nil, fmt.Errorf("goruntime/git: truncated pack index %s", indexPath)
+	}
+
+	p := &pack{
+		path:    strings.TrimSuffix(indexPath, ".idx") + ".pack",
+		names:   make([]Hash, count),
+		offsets: make([]int64, count),
+	}
+	for i := 0; i < count; i++ {
+		copy(p.names[i][:], idx[namesStart+i*20:])
+
+		offset := binary.BigEndian.Uint32(idx[offsetsStart+i*4:])
+		if offset&0x80000000 == 0 {
+			p.offsets[i] = int64(offset)
+			continue
+		}
+		// Offsets past 2GiB are stored in a separate table of 8 byte values.
+		large := largeStart + int(offset&0x7fffffff)*8
+		if len(idx) < large+8 {
+			return nil, fmt.Errorf("goruntime/git: truncated pack index %s", indexPath)
+		}
+		p.offsets[i] = int64(binary.BigEndian.Uint64(idx[large:]))
+	}
+	return p, nil
+}
+
+func (p *pack) find(h Hash) (int64, bool) {
+	i := sort.Search(len(p.names), func(i int) bool {
+		return bytes.Compare(p.names[i][:], h[:]) >= 0
+	})
+	if i < len(p.names) && p.names[i] == h {
+		return p.offsets[i], true
+	}
+	return 0, false
+}
+
+// readAt returns the fully resolved object stored at offset, applying deltas.
+func (p *pack) readAt(r *Repository, offset int64) (objectType, []byte, error) {
+	f, err := os.Open(p.path)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer f.Close()
+
+	// Walk down the delta chain to a base object, then apply the deltas in reverse.
+	var deltas [][]byte
+	for depth := 0; ; depth++ {
+		if depth > maxDeltaChain {
+			return 0, nil, errMalformedPack
+		}
+
+		kind, data, base, baseOffset, err := p.readEntry(f, offset)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch kind {
+		case packOfsDelta:
+			deltas = append(deltas, data)
+			offset = baseOffset
+			continue
+		case packRefDelta:
+			deltas = append(deltas, data)
+			if baseOffset, ok := p.find(base); ok {
+				offset = baseOffset
+				continue
+			}
+			baseKind, baseData, err := r.readObject(base)
+			if err != nil {
+				return 0, nil, err
+			}
+			return applyDeltas(baseKind, baseData, deltas)
+		}
+		return applyDeltas(objectType(kind), data, deltas)
+	}
+}
+
+func applyDeltas(kind objectType, data []byte, deltas [][]byte) (objectType, []byte, error) {
+	var err error
+	for i := len(deltas) - 1; i >= 0; i-- {
+		if data, err = applyDelta(data, deltas[i]); err != nil {
+			return 0, nil, err
+		}
+	}
+	return kind, data, nil
+}
+
+// sizeAt returns the type and size of the object stored at offset, reading
+// only entry headers and, for deltas, the start of the outermost delta.
+func (p *pack) sizeAt(r *Repository, offset int64) (objectType, int64, error) {
+	f, err := os.Open(p.path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	// A delta starts with the size of the object it produces; the type is
+	// that of the base at the bottom of the chain.
+	size := int64(-1)
+	for depth := 0; ; depth++ {
+		if depth > maxDeltaChain {
+			return 0, 0, errMalformedPack
+		}
+
+		br := bufio.NewReader(io.NewSectionReader(f, offset, 1<<62))
+		h, err := readEntryHeader(br, offset)
+		if err != nil {
+			return 0, 0, err
+		}
+		if h.kind != packOfsDelta && h.kind != packRefDelta {
+			if size < 0 {
+				size = h.size
+			}
+			return objectType(h.kind), size, nil
+		}
+
+		if size < 0 {
+			if size, err = deltaResultSize(br); err != nil {
+				return 0, 0, err
+			}
+		}
+		if h.kind == packOfsDelta {
+			offset = h.baseOffset
+			continue
+		}
+		if baseOffset, ok := p.find(h.base); ok {
+			offset = baseOffset
+			continue
+		}
+		kind, _, err := r.objectSize(h.base)
+		return kind, size, err
+	}
+}
+
+// deltaResultSize reads the size of the object a delta produces from the
+// start of its zlib data.
+func deltaResultSize(br *bufio.Reader) (int64, error) {
+	zr, err := zlib.NewReader(br)
+	if err != nil {
+		return 0, err
+	}
+	defer zr.Close()
+
+	zbr := bufio.NewReaderSize(zr, 16)
+	// The size of the base comes first.
+	if _, err := readDeltaSize(zbr); err != nil {
+		return 0, err
+	}
+	return readDeltaSize(zbr)
+}
+
+func readDeltaSize(r io.ByteReader) (int64, error) {
+	var size int64
+	for shift := uint(0); ; shift += 7 {
+		c, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		size |= int64(c&0x7f) << shift
+		if c&0x80 == 0 {
+			return size, nil
+		}
+	}
+}
+
+// entryHeader is the header of a pack entry. For ofs deltas baseOffset is the
+// offset of the base entry and for ref deltas base is the name of the base object.
+type entryHeader struct {
+	kind       int
+	size       int64
+	base       Hash
+	baseOffset int64
+}
+
+// readEntryHeader decodes the header of the pack entry at offset from br,
+// leaving br at the start of the entry's zlib data.
+func readEntryHeader(br *bufio.Reader, offset int64) (h entryHeader, err error) {
+	c, err := br.ReadByte()
+	if err != nil {
+		return h, err
+	}
+	h.kind = int(c>>4) & 7
+	h.size = int64(c & 0x0f)
+	for shift := uint(4); c&0x80 != 0; shift += 7 {
+		if c, err = br.ReadByte(); err != nil {
+			return h, err
+		}
+		h.size |= int64(c&0x7f) << shift
+	}
+
+	switch h.kind {
+	case packOfsDelta:
+		if c, err = br.ReadByte(); err != nil {
+			return h, err
+		}
+		distance := int64(c & 0x7f)
+		for c&0x80 != 0 {
+			if c, err = br.ReadByte(); err != nil {
+				return h, err
+			}
+			distance = ((distance + 1) << 7) | int64(c&0x7f)
+		}
+		h.baseOffset = offset - distance
+		if h.baseOffset < 0 || distance == 0 {
+			return h, errMalformedPack
+		}
+	case packRefDelta:
+		if _, err = io.ReadFull(br, h.base[:]); err != nil {
+			return h, err
+		}
+	case int(objectCommit), int(objectTree), int(objectBlob), int(objectTag):
+	default:
+		return h, errMalformedPack
+	}
+	return h, nil
+}
+
+// readEntry decodes the pack entry at offset. For ofs deltas baseOffset is the
+// offset of the base entry and for ref deltas base is the name of the base object.
+func (p *pack) readEntry(f *os.File, offset int64) (kind int, data []byte, base Hash, baseOffset int64, err error) {
+	br := bufio.NewReader(io.NewSectionReader(f, offset, 1<<62))
+	h, err := readEntryHeader(br, offset)
+	if err != nil {
+		return 0, nil, base, 0, err
+	}
+
+	zr, err := zlib.NewReader(br)
+	if err != nil {
+		return 0, nil, base, 0, err
+	}
+	defer zr.Close()
+
+	data = make([]byte, h.size)
+	if _, err = io.ReadFull(zr, data); err != nil {
+		return 0, nil, base, 0, err
+	}
+	return h.kind, data, h.base, h.baseOffset, nil
+}
+
+// applyDelta rebuilds an object from its base and a git delta.
+func applyDelta(base []byte, delta []byte) ([]byte, error) {
+	readSize := func() (int, error) {
+		size, shift := 0, uint(0)
+		for {
+			if len(delta) == 0 {
+				return 0, errMalformedPack
+			}
+			c := delta[0]
+			delta = delta[1:]
+			size |= int(c&0x7f) << shift
+			shift += 7
+			if c&0x80 == 0 {
+				return size, nil
+			}
+		}
+	}
+
+	baseSize, err := readSize()
+	if err != nil || baseSize != len(base) {
+		return nil, errMalformedPack
+	}
+	targetSize, err := readSize()
+	if err != nil {
+		return nil, errMalformedPack
+	}
+
+	out := make([]byte, 0, targetSize)
+	for len(delta) > 0 {
+		cmd := delta[0]
+		delta = delta[1:]
+
+		switch {
+		case cmd&0x80 != 0:
+			// Copy a range of the base object. The low bits say which offset
+			// and size bytes follow.
+			var offset, size int
+			for i := uint(0); i < 4; i++ {
+				if cmd&(1<<i) != 0 {
+					if len(delta) == 0 {
+						return nil, errMalformedPack
+					}
+					offset |= int(delta[0]) << (8 * i)
+					delta = delta[1:]
+				}
+			}
+			for i := uint(0); i < 3; i++ {
+				if cmd&(0x10<<i) != 0 {
+					if len(delta) == 0 {
+						return nil, errMalformedPack
+					}
+					size |= int(delta[0]) << (8 * i)
+					delta = delta[1:]
+				}
+			}
+			if size == 0 {
+				size = 0x10000
+			}
+			if offset+size > len(base) {
+				return nil, errMalformedPack
+			}
+			out = append(out, base[offset:offset+size]...)
+		case cmd != 0:
+			// Insert the next cmd bytes of the delta verbatim.
+			if int(cmd) > len(delta) {
+				return nil, errMalformedPack
+			}
+			out = append(out, delta[:cmd]...)
+			delta = delta[cmd:]
+		default:
+			return nil, errMalformedPack
+		}
+	}
+
+	if len(out) != targetSize {
+		return nil, errMalformedPack
+	}
+	return out, nil
+}
@@ -0,0 +1,435 @@
+// Package git reads commits and trees from a local git repository without
+// shelling out to git or touching the network. It understands loose objects,
+// pack files, packed refs and linked worktrees, which is enough to resolve a
+// ref and read the runtime tree stored at it.
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotRepository is returned by Open when no git repository contains the given path.
+var ErrNotRepository = errors.New("goruntime/git: not a git repository")
+
+// Hash is the SHA-1 name of a git object.
+type Hash [20]byte
+
+func (h Hash) String() string { return hex.EncodeToString(h[:]) }
+
+// ParseHash parses a full 40 character hexadecimal object name.
+func ParseHash(s string) (Hash, error) {
+	var h Hash
+	if len(s) != 2*len(h) {
+		return h, fmt.Errorf("goruntime/git: invalid object name %q", s)
+	}
+	if _, err := hex.Decode(h[:], []byte(s)); err != nil {
+		return h, fmt.Errorf("goruntime/git: invalid object name %q", s)
+	}
+	return h, nil
+}
+
+// Commit is the subset of a commit object needed to identify a runtime revision.
+type Commit struct {
+	Hash       Hash
+	Tree       Hash
+	Parents    []Hash
+	CommitTime time.Time
+}
+
+// Repository is a git repository opened from a working tree.
+type Repository struct {
+	// WorkTree is the root of the working tree the repository was opened from.
+	WorkTree string
+	gitDir   string
+	// commonDir holds objects and shared refs; it differs from gitDir for linked worktrees.
+	commonDir string
+
+	mu    sync.Mutex
+	packs []*pack
+}
+
+// Open finds the repository whose working tree contains path, searching parent
+// directories the same way git does. Symlinks in path are resolved first so a
+// runtime root that links into a checkout is attributed to that checkout.
+func Open(path string) (*Repository, error) {
+	dir, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil, err
+	}
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		gitDir, err := findGitDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		if gitDir != "" {
+			r := &Repository{WorkTree: dir, gitDir: gitDir, commonDir: gitDir}
+			if common, err := ioutil.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+				r.commonDir = resolveRelative(gitDir, strings.TrimSpace(string(common)))
+			}
+			return r, nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, ErrNotRepository
+		}
+		dir = parent
+	}
+}
+
+// findGitDir returns the git directory of the working tree rooted at dir, or ""
+// if dir is not the root of a working tree.
+func findGitDir(dir string) (string, error) {
+	dotGit := filepath.Join(dir, ".git")
+	info, err := os.Stat(dotGit)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return dotGit, nil
+	}
+
+	// Linked worktrees and submodules use a ".git" file pointing at the real git directory.
+	contents, err := ioutil.ReadFile(dotGit)
+	if err != nil {
+		return "", err
+	}
+	line := strings.TrimSpace(string(contents))
+	if !strings.HasPrefix(line, "gitdir:") {
+		return "", fmt.Errorf("goruntime/git: malformed %s", dotGit)
+	}
+	return resolveRelative(dir, strings.TrimSpace(strings.TrimPrefix(line, "gitdir:"))), nil
+}
+
+func resolveRelative(base string, path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(base, path)
+}
+
+// Head returns the commit currently checked out in the working tree.
+func (r *Repository) Head() (*Commit, error) {
+	return r.ResolveCommit("HEAD")
+}
+
+// ResolveCommit resolves ref to a commit. ref may be a full object name, "HEAD",
+// a full ref name such as "refs/heads/main", or a short branch, tag or remote
+// name which is expanded following git's rules. Annotated tags are peeled.
+// Like in git, ref may be followed by "~<n>" to select its n-th generation
+// ancestor and "^<n>" to select its n-th parent, as in "HEAD~2" or "main^2".
+func (r *Repository) ResolveCommit(ref string) (*Commit, error) {
+	name, ancestry := ref, ""
+	if i := strings.IndexAny(ref, "~^"); i > 0 {
+		name, ancestry = ref[:i], ref[i:]
+	}
+
+	h, err := r.ResolveRef(name)
+	if err != nil {
+		return nil, err
+	}
+	c, err := r.peelCommit(ref, h)
+	if err != nil {
+		return nil, err
+	}
+
+	for ancestry != "" {
+		op := ancestry[0]
+		end := 1
+		for end < len(ancestry) && ancestry[end] >= '0' && ancestry[end] <= '9' {
+			end++
+		}
+		n := 1
+		if end > 1 {
+			if n, err = strconv.Atoi(ancestry[1:end]); err != nil {
+				return nil, fmt.Errorf("goruntime/git: invalid revision %q", ref)
+			}
+		}
+		ancestry = ancestry[end:]
+
+		if op == '^' {
+			if n == 0 {
+				continue
+			}
+			if n > len(c.Parents) {
+				return nil, fmt.Errorf("goruntime/git: %s: commit %s has no parent %d", ref, c.Hash, n)
+			}
+			if c, err = r.peelCommit(ref, c.Parents[n-1]); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		for ; n > 0; n-- {
+			if len(c.Parents) == 0 {
+				return nil, fmt.Errorf("goruntime/git: %s: commit %s has no parent", ref, c.Hash)
+			}
+			if c, err = r.peelCommit(ref, c.Parents[0]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return c, nil
+}
+
+// peelCommit reads the commit h names, following annotated tags.
+func (r *Repository) peelCommit(ref string, h Hash) (*Commit, error) {
+	for {
+		kind, data, err := r.readObject(h)
+		if err != nil {
+			return nil, err
+		}
+		switch kind {
+		case objectCommit:
+			return parseCommit(h, data)
+		case objectTag:
+			if h, err = parseTagTarget(data); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("goruntime/git: %s is a %s, not a commit", ref, kind)
+		}
+	}
+}
+
+// ResolveRef resolves ref to the object it names without peeling tags.
+func (r *Repository) ResolveRef(ref string) (Hash, error) {
+	if h, err := ParseHash(ref); err == nil {
+		return h, nil
+	}
+
+	for _, name := range refCandidates(ref) {
+		h, ok, err := r.readRef(name, 0)
+		if err != nil {
+			return Hash{}, err
+		}
+		if ok {
+			return h, nil
+		}
+	}
+	return Hash{}, fmt.Errorf("goruntime/git: unknown revision %q", ref)
+}
+
+// refCandidates returns the ref names ref may abbreviate, in the order git
+// tries them.
+func refCandidates(ref string) []string {
+	candidates := []string{ref}
+	if ref != "HEAD" && !strings.HasPrefix(ref, "refs/") {
+		candidates = append(candidates,
+			"refs/"+ref,
+			"refs/tags/"+ref,
+			"refs/heads/"+ref,
+			"refs/remotes/"+ref,
+			"refs/remotes/"+ref+"/HEAD",
+		)
+	}
+	return candidates
+}
+
+// RefPaths returns the files that decide which object ref resolves to: every
+// loose ref file it may be read from, following symbolic refs as they point
+// now, and packed-refs. Most of them usually do not exist. It returns nil if
+// ref is an object name, which never resolves to anything else.
+func (r *Repository) RefPaths(ref string) []string {
+	if i := strings.IndexAny(ref, "~^"); i > 0 {
+		ref = ref[:i]
+	}
+	if _, err := ParseHash(ref); err == nil {
+		return nil
+	}
+
+	var paths []string
+	for _, name := range refCandidates(ref) {
+		paths = r.appendRefPaths(paths, name, 0)
+	}
+	return append(paths, filepath.Join(r.commonDir, "packed-refs"))
+}
+
+func (r *Repository) appendRefPaths(paths []string, name string, depth int) []string {
+	for _, dir := range r.refDirs() {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		paths = append(paths, p)
+
+		contents, err := ioutil.ReadFile(p)
+		if err != nil || depth >= maxSymrefDepth {
+			continue
+		}
+		if line := strings.TrimSpace(string(contents)); strings.HasPrefix(line, "ref:") {
+			paths = r.appendRefPaths(paths, strings.TrimSpace(strings.TrimPrefix(line, "ref:")), depth+1)
+		}
+	}
+	return paths
+}
+
+// refDirs returns the directories loose refs are read from, in order: HEAD and
+// other per-worktree refs live in gitDir, shared refs in commonDir.
+func (r *Repository) refDirs() []string {
+	if r.commonDir != r.gitDir {
+		return []string{r.gitDir, r.commonDir}
+	}
+	return []string{r.gitDir}
+}
+
+// maxSymrefDepth bounds symbolic ref chains, matching git's own limit.
+const maxSymrefDepth = 5
+
+func (r *Repository) readRef(name string, depth int) (Hash, bool, error) {
+	if depth > maxSymrefDepth {
+		return Hash{}, false, fmt.Errorf("goruntime/git: symbolic ref loop at %q", name)
+	}
+
+	for _, dir := range r.refDirs() {
+		contents, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if os.IsNotExist(err) || isDirError(err) {
+			continue
+		}
+		if err != nil {
+			return Hash{}, false, err
+		}
+
+		line := strings.TrimSpace(string(contents))
+		if strings.HasPrefix(line, "ref:") {
+			return r.readRef(strings.TrimSpace(strings.TrimPrefix(line, "ref:")), depth+1)
+		}
+		h, err := ParseHash(line)
+		if err != nil {
+			return Hash{}, false, fmt.Errorf("goruntime/git: malformed ref %q", name)
+		}
+		return h, true, nil
+	}
+
+	return r.readPackedRef(name)
+}
+
+func isDirError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		info, statErr := os.Stat(pathErr.Path)
+		return statErr == nil && info.IsDir()
+	}
+	return false
+}
+
+func (r *Repository) readPackedRef(name string) (Hash, bool, error) {
+	f, err := os.Open(filepath.Join(r.commonDir, "packed-refs"))
+	if os.IsNotExist(err) {
+		return Hash{}, false, nil
+	}
+	if err != nil {
+		return Hash{}, false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		// Skip the header and "^<hash>" peeled tag lines.
+		if line == "" || line[0] == '#' || line[0] == '^' {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) != 2 || fields[1] != name {
+			continue
+		}
+		h, err := ParseHash(fields[0])
+		if err != nil {
+			return Hash{}, false, fmt.Errorf("goruntime/git: malformed packed ref %q", name)
+		}
+		return h, true, nil
+	}
+	return Hash{}, false, scanner.Err()
+}
+
+func parseCommit(h Hash, data []byte) (*Commit, error) {
+	c := &Commit{Hash: h}
+	haveTree := false
+
+	for _, line := range bytes.Split(headerOf(data), []byte("\n")) {
+		switch {
+		case bytes.HasPrefix(line, []byte("tree ")):
+			tree, err := ParseHash(string(line[len("tree "):]))
+			if err != nil {
+				return nil, err
+			}
+			c.Tree = tree
+			haveTree = true
+		case bytes.HasPrefix(line, []byte("parent ")):
+			parent, err := ParseHash(string(line[len("parent "):]))
+			if err != nil {
+				return nil, err
+			}
+			c.Parents = append(c.Parents, parent)
+		case bytes.HasPrefix(line, []byte("committer ")):
+			t, err := parseSignatureTime(line)
+			if err != nil {
+				return nil, fmt.Errorf("goruntime/git: commit %s: %s", h, err)
+			}
+			c.CommitTime = t
+		}
+	}
+
+	if !haveTree {
+		return nil, fmt.Errorf("goruntime/git: commit %s has no tree", h)
+	}
+	return c, nil
+}
+
+func parseTagTarget(data []byte) (Hash, error) {
+	for _, line := range bytes.Split(headerOf(data), []byte("\n")) {
+		if bytes.HasPrefix(line, []byte("object ")) {
+			return ParseHash(string(line[len("object "):]))
+		}
+	}
+	return Hash{}, errors.New("goruntime/git: tag has no object")
+}
+
+// headerOf returns the header lines of a commit or tag, before the message.
+func headerOf(data []byte) []byte {
+	if i := bytes.Index(data, []byte("\n\n")); i >= 0 {
+		return data[:i]
+	}
+	return data
+}
+
+// parseSignatureTime parses the time from "committer Name <email> 1600000000 -0700".
+func parseSignatureTime(line []byte) (time.Time, error) {
+	end := bytes.LastIndexByte(line, '>')
+	if end < 0 {
+		return time.Time{}, errors.New("malformed signature")
+	}
+	fields := strings.Fields(string(line[end+1:]))
+	if len(fields) != 2 {
+		return time.Time{}, errors.New("malformed signature")
+	}
+
+	seconds, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	zone, err := time.Parse("-0700", fields[1])
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(seconds, 0).In(zone.Location()), nil
+}
@@ -0,0 +1,206 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lyft/goruntime/loader/git/gittest"
+	"github.com/stretchr/testify/require"
+)
+
+func runGit(t *testing.T, dir string, args ...string) string {
+	return gittest.Run(t, dir, nil, args...)
+}
+
+func writeFile(t *testing.T, path string, contents string) {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTestRepo creates a repository with two commits, tagging the first one.
+func newTestRepo(t *testing.T) (dir string, first string, second string) {
+	gittest.SkipIfMissing(t)
+
+	dir, err := ioutil.TempDir("", "goruntime_git")
+	require.NoError(t, err)
+
+	runGit(t, dir, "init", "-q")
+	// A large, slowly changing file makes git gc store deltas.
+	large := strings.Repeat("runtime value line\n", 500)
+	writeFile(t, filepath.Join(dir, "runtime/app/file1"), "hello")
+	writeFile(t, filepath.Join(dir, "runtime/app/dir/file2"), "34")
+	writeFile(t, filepath.Join(dir, "runtime/app/large"), large)
+	runGit(t, dir, "add", "-A")
+	gittest.Run(t, dir, []string{"GIT_COMMITTER_DATE=1600000000 +0200"}, "commit", "-q", "-m", "first")
+	first = runGit(t, dir, "rev-parse", "HEAD")
+	runGit(t, dir, "tag", "-a", "v1", "-m", "v1")
+
+	writeFile(t, filepath.Join(dir, "runtime/app/file1"), "hello2")
+	writeFile(t, filepath.Join(dir, "runtime/app/large"), large+"one more line\n")
+	runGit(t, dir, "add", "-A")
+	runGit(t, dir, "commit", "-q", "-m", "second")
+	second = runGit(t, dir, "rev-parse", "HEAD")
+
+	return dir, first, second
+}
+
+func readAll(t *testing.T, repo *Repository, commit *Commit, dir string) map[string]string {
+	files := map[string]string{}
+	err := repo.Walk(commit, dir, func(path string, mode Mode, object Hash) error {
+		if !mode.IsRegular() {
+			return nil
+		}
+		contents, err := repo.ReadBlob(object)
+		if err != nil {
+			return err
+		}
+		size, err := repo.BlobSize(object)
+		if err != nil {
+			return err
+		}
+		require.Equal(t, int64(len(contents)), size, path)
+		files[path] = string(contents)
+		return nil
+	})
+	require.NoError(t, err)
+	return files
+}
+
+func testRepository(t *testing.T, dir string, first string, second string) {
+	assert := require.New(t)
+
+	repo, err := Open(filepath.Join(dir, "runtime", "app"))
+	assert.NoError(err)
+	assert.Equal(dir, repo.WorkTree)
+
+	head, err := repo.Head()
+	assert.NoError(err)
+	assert.Equal(second, head.Hash.String())
+
+	tagged, err := repo.ResolveCommit("v1")
+	assert.NoError(err)
+	assert.Equal(first, tagged.Hash.String())
+	assert.True(time.Unix(1600000000, 0).Equal(tagged.CommitTime))
+	_, offset := tagged.CommitTime.Zone()
+	assert.Equal(2*60*60, offset)
+
+	byHash, err := repo.ResolveCommit(first)
+	assert.NoError(err)
+	assert.Equal(tagged.Tree, byHash.Tree)
+
+	files := readAll(t, repo, tagged, "runtime/app")
+	keys := make([]string, 0, len(files))
+	for k := range files {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	assert.Equal([]string{"dir/file2", "file1", "large"}, keys)
+	assert.Equal("hello", files["file1"])
+	assert.Equal("34", files["dir/file2"])
+
+	files = readAll(t, repo, head, "runtime/app")
+	assert.Equal("hello2", files["file1"])
+	assert.True(strings.HasSuffix(files["large"], "one more line\n"))
+
+	assert.Equal([]Hash{tagged.Hash}, head.Parents)
+	for _, rev := range []string{"HEAD~1", "HEAD^", "HEAD~", "HEAD^1", "HEAD^0~1", "v1~0"} {
+		parent, err := repo.ResolveCommit(rev)
+		assert.NoError(err, rev)
+		assert.Equal(first, parent.Hash.String(), rev)
+	}
+	_, err = repo.ResolveCommit("HEAD~2")
+	assert.Error(err)
+	_, err = repo.ResolveCommit("HEAD^2")
+	assert.Error(err)
+
+	_, err = repo.BlobSize(head.Tree)
+	assert.Error(err)
+
+	_, err = repo.ResolveCommit("does-not-exist")
+	assert.Error(err)
+	assert.Error(repo.Walk(head, "runtime/missing", func(string, Mode, Hash) error { return nil }))
+}
+
+func TestRepository_Loose(t *testing.T) {
+	dir, first, second := newTestRepo(t)
+	defer os.RemoveAll(dir)
+
+	testRepository(t, dir, first, second)
+}
+
+func TestRepository_Packed(t *testing.T) {
+	dir, first, second := newTestRepo(t)
+	defer os.RemoveAll(dir)
+
+	runGit(t, dir, "gc", "-q", "--aggressive")
+	runGit(t, dir, "pack-refs", "--all")
+	loose, err := filepath.Glob(filepath.Join(dir, ".git", "objects", "??", "*"))
+	require.NoError(t, err)
+	require.Empty(t, loose)
+
+	testRepository(t, dir, first, second)
+}
+
+func TestRepository_Worktree(t *testing.T) {
+	dir, first, second := newTestRepo(t)
+	defer os.RemoveAll(dir)
+
+	worktree := filepath.Join(dir, "linked")
+	runGit(t, dir, "worktree", "add", "-q", worktree, first)
+
+	repo, err := Open(worktree)
+	require.NoError(t, err)
+	head, err := repo.Head()
+	require.NoError(t, err)
+	require.Equal(t, first, head.Hash.String())
+
+	// Shared refs are read from the main repository.
+	commit, err := repo.ResolveCommit("master")
+	if err != nil {
+		commit, err = repo.ResolveCommit("main")
+	}
+	require.NoError(t, err)
+	require.Equal(t, second, commit.Hash.String())
+}
+
+func TestOpen_NotRepository(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goruntime_git")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	_, err = Open(dir)
+	require.Equal(t, ErrNotRepository, err)
+}
+
+func TestRepository_RefPaths(t *testing.T) {
+	assert := require.New(t)
+
+	dir, first, _ := newTestRepo(t)
+	defer os.RemoveAll(dir)
+
+	repo, err := Open(dir)
+	assert.NoError(err)
+	gitDir := filepath.Join(dir, ".git")
+	branch := strings.TrimPrefix(runGit(t, dir, "symbolic-ref", "HEAD"), "refs/heads/")
+
+	// HEAD is followed to the branch it points at.
+	paths := repo.RefPaths("HEAD")
+	assert.Contains(paths, filepath.Join(gitDir, "HEAD"))
+	assert.Contains(paths, filepath.Join(gitDir, "refs", "heads", branch))
+	assert.Contains(paths, filepath.Join(gitDir, "packed-refs"))
+
+	paths = repo.RefPaths("v1~1")
+	assert.Contains(paths, filepath.Join(gitDir, "refs", "tags", "v1"))
+	assert.Contains(paths, filepath.Join(gitDir, "refs", "heads", "v1"))
+
+	assert.Nil(repo.RefPaths(first))
+}
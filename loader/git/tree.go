@@ -0,0 +1,155 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Mode is the file mode of a tree entry.
+type Mode uint32
+
+// Tree entry modes used by git.
+const (
+	ModeDir        Mode = 0040000
+	ModeFile       Mode = 0100644
+	ModeExecutable Mode = 0100755
+	ModeSymlink    Mode = 0120000
+	ModeSubmodule  Mode = 0160000
+)
+
+// IsRegular reports whether the entry is a regular (possibly executable) file.
+func (m Mode) IsRegular() bool { return m == ModeFile || m == ModeExecutable }
+
+// WalkFunc is called for every entry visited by Walk. path is slash separated
+// and relative to the walked directory. Returning filepath.SkipDir from a
+// directory skips its contents; any other error stops the walk.
+type WalkFunc func(path string, mode Mode, object Hash) error
+
+type treeEntry struct {
+	name   string
+	mode   Mode
+	object Hash
+}
+
+// Walk visits the contents of dir within commit's tree in tree order. dir
+// is slash separated and relative to the repository root; "" or "." walks the
+// whole tree.
+func (r *Repository) Walk(commit *Commit, dir string, fn WalkFunc) error {
+	tree, err := r.lookupTree(commit.Tree, dir)
+	if err != nil {
+		return err
+	}
+	return r.walkTree(tree, "", fn)
+}
+
+// BlobSize returns the size of the blob named h without reading its contents,
+// so that oversized blobs can be skipped before they are read.
+func (r *Repository) BlobSize(h Hash) (int64, error) {
+	kind, size, err := r.objectSize(h)
+	if err != nil {
+		return 0, err
+	}
+	if kind != objectBlob {
+		return 0, fmt.Errorf("goruntime/git: %s is a %s, not a blob", h, kind)
+	}
+	return size, nil
+}
+
+// ReadBlob returns the contents of the blob named h.
+func (r *Repository) ReadBlob(h Hash) ([]byte, error) {
+	kind, data, err := r.readObject(h)
+	if err != nil {
+		return nil, err
+	}
+	if kind != objectBlob {
+		return nil, fmt.Errorf("goruntime/git: %s is a %s, not a blob", h, kind)
+	}
+	return data, nil
+}
+
+func (r *Repository) lookupTree(root Hash, dir string) (Hash, error) {
+	dir = path.Clean(filepath.ToSlash(dir))
+	if dir == "." || dir == "/" {
+		return root, nil
+	}
+
+	tree := root
+	for _, name := range strings.Split(strings.Trim(dir, "/"), "/") {
+		entries, err := r.readTree(tree)
+		if err != nil {
+			return Hash{}, err
+		}
+		found := false
+		for _, e := range entries {
+			if e.name == name && e.mode == ModeDir {
+				tree, found = e.object, true
+				break
+			}
+		}
+		if !found {
+			return Hash{}, fmt.Errorf("goruntime/git: directory %q not found in tree %s", dir, root)
+		}
+	}
+	return tree, nil
+}
+
+func (r *Repository) walkTree(tree Hash, prefix string, fn WalkFunc) error {
+	entries, err := r.readTree(tree)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		p := path.Join(prefix, e.name)
+		err := fn(p, e.mode, e.object)
+		if e.mode != ModeDir {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if err == filepath.SkipDir {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := r.walkTree(e.object, p, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Repository) readTree(h Hash) ([]treeEntry, error) {
+	kind, data, err := r.readObject(h)
+	if err != nil {
+		return nil, err
+	}
+	if kind != objectTree {
+		return nil, fmt.Errorf("goruntime/git: %s is a %s, not a tree", h, kind)
+	}
+
+	// Each entry is "<octal mode> <name>\x00<20 byte object name>".
+	var entries []treeEntry
+	for len(data) > 0 {
+		space := bytes.IndexByte(data, ' ')
+		nul := bytes.IndexByte(data, 0)
+		if space < 0 || nul < space || len(data) < nul+1+20 {
+			return nil, fmt.Errorf("goruntime/git: malformed tree %s", h)
+		}
+		mode, err := strconv.ParseUint(string(data[:space]), 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("goruntime/git: malformed tree %s", h)
+		}
+		e := treeEntry{name: string(data[space+1 : nul]), mode: Mode(mode)}
+		copy(e.object[:], data[nul+1:])
+		entries = append(entries, e)
+		data = data[nul+1+20:]
+	}
+	return entries, nil
+}
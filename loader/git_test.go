@@ -0,0 +1,111 @@
+package loader
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lyft/goruntime/loader/git/gittest"
+	"github.com/lyft/goruntime/snapshot"
+	"github.com/stretchr/testify/require"
+)
+
+// gitCommand runs git in dir, committing at a fixed time.
+func gitCommand(t *testing.T, dir string, args ...string) string {
+	return gittest.Run(t, dir, []string{"GIT_COMMITTER_DATE=1600000000 +0000"}, args...)
+}
+
+func TestGitRevision(t *testing.T) {
+	gittest.SkipIfMissing(t)
+	assert := require.New(t)
+
+	tempDir, err := ioutil.TempDir("", "git_runtime_test")
+	assert.NoError(err)
+	defer os.RemoveAll(tempDir)
+
+	gitCommand(t, tempDir, "init", "-q")
+	makeFileInDir(assert, tempDir+"/runtime/app/file1", "hello")
+	makeFileInDir(assert, tempDir+"/runtime/app/dir/file2", "34")
+	makeFileInDir(assert, tempDir+"/runtime/app/.dir/file3", "hidden")
+	gitCommand(t, tempDir, "add", "-A")
+	gitCommand(t, tempDir, "commit", "-q", "-m", "first")
+	gitCommand(t, tempDir, "tag", "pinned")
+	first := gitCommand(t, tempDir, "rev-parse", "HEAD")
+
+	makeFileInDir(assert, tempDir+"/runtime/app/file1", "hello2")
+	gitCommand(t, tempDir, "commit", "-q", "-a", "-m", "second")
+	second := gitCommand(t, tempDir, "rev-parse", "HEAD")
+
+	// Uncommitted changes are visible on disk but not in the pinned tree.
+	makeFileInDir(assert, tempDir+"/runtime/app/file1", "dirty")
+
+	runtimePath := filepath.Join(tempDir, "runtime")
+
+	t.Run("TrackGitRevision", func(t *testing.T) {
+		loader, err := New2(runtimePath, "app", nullScope, &DirectoryRefresher{}, IgnoreDotFiles, TrackGitRevision)
+		assert.NoError(err)
+		defer loader.(*Loader).Close()
+		s := loader.Snapshot()
+		assert.Equal("dirty", s.Get("file1"))
+		assert.Equal(second, snapshot.Metadata(s)[GitCommitMetadataKey])
+		assert.Equal("2020-09-13T12:26:40Z", snapshot.Metadata(s)[GitCommitTimeMetadataKey])
+	})
+
+	t.Run("GitRef", func(t *testing.T) {
+		loader, err := New2(runtimePath, "app", nullScope, &DirectoryRefresher{}, IgnoreDotFiles, GitRef("pinned"))
+		assert.NoError(err)
+		defer loader.(*Loader).Close()
+		s := loader.Snapshot()
+		assert.Equal("hello", s.Get("file1"))
+		assert.Equal(uint64(34), s.GetInteger("dir.file2", 0))
+		assert.Equal("", s.Get(".dir.file3"))
+		assert.Equal(int64(1600000000), s.GetModified("file1").Unix())
+		assert.Equal(first, snapshot.Metadata(s)[GitCommitMetadataKey])
+		assert.Equal("pinned", snapshot.Metadata(s)[GitRefMetadataKey])
+	})
+
+	t.Run("GitRefMaxFileSize", func(t *testing.T) {
+		loader, err := New2(runtimePath, "app", nullScope, &DirectoryRefresher{}, IgnoreDotFiles, GitRef("pinned"),
+			MaxFileSize(4), WithLogger(NopLogger))
+		assert.NoError(err)
+		defer loader.(*Loader).Close()
+		assert.Equal([]string{"dir.file2"}, loader.Snapshot().Keys())
+		violations := loader.(*Loader).Status().LimitViolations
+		assert.Equal([]LimitViolation{{Limit: FileSizeLimit, Path: "runtime/app/file1", Max: 4}}, violations)
+	})
+
+	t.Run("GitRefUnknown", func(t *testing.T) {
+		loader, err := New2(runtimePath, "app", nullScope, &DirectoryRefresher{}, GitRef("missing"), WithLogger(NopLogger))
+		assert.NoError(err)
+		defer loader.(*Loader).Close()
+		assert.Empty(loader.Snapshot().Keys())
+		assert.EqualError(loader.(*Loader).Status().LastError, `resolving git ref: goruntime/git: unknown revision "missing"`)
+	})
+
+	t.Run("GitRefMoved", func(t *testing.T) {
+		gitCommand(t, tempDir, "tag", "moving", first)
+		loader, err := New2(runtimePath, "app", nullScope, &DirectoryRefresher{}, GitRef("moving"), WithLogger(NopLogger))
+		assert.NoError(err)
+		defer loader.(*Loader).Close()
+		assert.Equal("hello", loader.Snapshot().Get("file1"))
+		update := make(chan int, 1)
+		loader.AddUpdateCallback(update)
+
+		// Moving the ref reloads the runtime although no runtime file changed.
+		gitCommand(t, tempDir, "tag", "-f", "moving", second)
+		select {
+		case <-update:
+		case <-time.After(5 * time.Second):
+			t.Fatal("no update after moving the ref")
+		}
+		assert.Equal("hello2", loader.Snapshot().Get("file1"))
+		assert.Equal(second, snapshot.Metadata(loader.Snapshot())[GitCommitMetadataKey])
+
+		// Once the ref no longer resolves, reloads fail and keep the snapshot.
+		gitCommand(t, tempDir, "tag", "-d", "moving")
+		assert.Eventually(func() bool { return loader.(*Loader).Status().LastError != nil }, 5*time.Second, 10*time.Millisecond)
+		assert.Equal("hello2", loader.Snapshot().Get("file1"))
+	})
+}
@@ -0,0 +1,93 @@
+package loader
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// States of the goroutine watching a loader's source for changes.
+const (
+	watchNotStarted int32 = iota
+	watchRunning
+	watchStopped
+)
+
+// HealthThresholds decide when Health reports a loaded runtime as unhealthy.
+// The zero value only fails loaders that never loaded a snapshot, stopped
+// watching for changes or lost their runtime path.
+type HealthThresholds struct {
+	// MaxAge fails the check once the current snapshot was published longer
+	// ago than MaxAge. Snapshots are only published when the runtime changes,
+	// so it only suits runtimes that are republished regularly. Zero disables it.
+	MaxAge time.Duration
+	// FailOnReloadError fails the check while the most recent reload is
+	// rejected, even though the previous snapshot is still served.
+	FailOnReloadError bool
+}
+
+// WithHealthThresholds sets the thresholds used by Health.
+func WithHealthThresholds(t HealthThresholds) Option {
+	return func(l *Loader) { l.healthThresholds = t }
+}
+
+// Health describes whether a Loader has loaded its runtime and is keeping it
+// up to date.
+type Health struct {
+	// Healthy is false if any of Failures apply.
+	Healthy bool
+	// Failures describes why the check fails, and is empty when Healthy.
+	Failures []string
+	// Loaded reports whether a snapshot has been loaded successfully.
+	Loaded bool
+	// LoadedAt is when the current snapshot was published.
+	LoadedAt time.Time
+	// Watching reports whether the loader is watching its source for changes.
+	// Loaders created with Load never watch.
+	Watching bool
+	// LastError is set if the most recent reload was rejected.
+	LastError error
+	// Path is the watched runtime directory, empty for loaders created with
+	// NewFromSource, and PathExists whether it still exists.
+	Path       string
+	PathExists bool
+}
+
+// Health reports whether the loader has loaded its runtime and is keeping it
+// up to date, failing according to the thresholds set with WithHealthThresholds.
+func (l *Loader) Health() Health {
+	status := l.Status()
+	h := Health{
+		Loaded:    !status.LoadedAt.IsZero(),
+		LoadedAt:  status.LoadedAt,
+		Watching:  atomic.LoadInt32(&l.watchState) == watchRunning,
+		LastError: status.LastError,
+	}
+
+	if !h.Loaded {
+		h.Failures = append(h.Failures, "no snapshot has been loaded")
+	}
+	if atomic.LoadInt32(&l.watchState) == watchStopped {
+		h.Failures = append(h.Failures, "stopped watching for changes")
+	}
+	if l.watchPath != "" {
+		h.Path = filepath.Join(l.watchPath, l.subdirectory)
+		_, err := os.Stat(h.Path)
+		if h.PathExists = err == nil; !h.PathExists {
+			h.Failures = append(h.Failures, fmt.Sprintf("runtime path is unavailable: %s", err))
+		}
+	}
+	if max := l.healthThresholds.MaxAge; max > 0 && h.Loaded {
+		if age := time.Since(h.LoadedAt); age > max {
+			h.Failures = append(h.Failures, fmt.Sprintf("snapshot is %s old, more than %s", age.Round(time.Second), max))
+		}
+	}
+	if l.healthThresholds.FailOnReloadError && h.LastError != nil {
+		h.Failures = append(h.Failures, fmt.Sprintf("last reload failed: %s", h.LastError))
+	}
+
+	h.Healthy = len(h.Failures) == 0
+	return h
+}
@@ -0,0 +1,117 @@
+package loader
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/lyft/goruntime/snapshot/entry"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealth(t *testing.T) {
+	assert := require.New(t)
+
+	tempDir, err := ioutil.TempDir("", "health_test")
+	assert.NoError(err)
+	defer os.RemoveAll(tempDir)
+
+	makeFileInDir(assert, tempDir+"/app/file1", "hello")
+
+	loader, err := New2(tempDir, "app", nullScope, &manualRefresher{},
+		WithHealthThresholds(HealthThresholds{MaxAge: time.Minute, FailOnReloadError: true}))
+	assert.NoError(err)
+	defer loader.(*Loader).Close()
+	l := loader.(*Loader)
+
+	h := l.Health()
+	assert.True(h.Healthy, "%v", h.Failures)
+	assert.True(h.Loaded)
+	assert.True(h.Watching)
+	assert.Equal(tempDir+"/app", h.Path)
+	assert.True(h.PathExists)
+
+	l.statusMu.Lock()
+	l.status.LoadedAt = time.Now().Add(-2 * time.Minute)
+	l.statusMu.Unlock()
+	h = l.Health()
+	assert.False(h.Healthy)
+	assert.Equal([]string{"snapshot is 2m0s old, more than 1m0s"}, h.Failures)
+
+	makeFileInDir(assert, tempDir+"/app/file2", "world")
+	l.maxKeys, l.limitAction = 1, RejectOverLimit
+	assert.Error(l.reload())
+	h = l.Health()
+	assert.False(h.Healthy)
+	assert.Len(h.Failures, 2)
+	assert.Contains(h.Failures[1], "last reload failed")
+
+	l.maxKeys = 0
+	assert.NoError(l.reload())
+	assert.True(l.Health().Healthy)
+
+	assert.NoError(os.Rename(tempDir+"/app", tempDir+"/moved"))
+	h = l.Health()
+	assert.False(h.Healthy)
+	assert.False(h.PathExists)
+	assert.Len(h.Failures, 1)
+	assert.Contains(h.Failures[0], "runtime path is unavailable")
+}
+
+func TestHealthLoad(t *testing.T) {
+	assert := require.New(t)
+
+	tempDir, err := ioutil.TempDir("", "health_test")
+	assert.NoError(err)
+	defer os.RemoveAll(tempDir)
+
+	makeFileInDir(assert, tempDir+"/app/file1", "hello")
+	makeFileInDir(assert, tempDir+"/app/file2", "world")
+
+	// Loaders that never watch are not failed for it.
+	l, err := Load(tempDir, "app", nullScope)
+	assert.NoError(err)
+	h := l.Health()
+	assert.True(h.Healthy, "%v", h.Failures)
+	assert.False(h.Watching)
+
+	l, err = Load(tempDir, "app", nullScope, MaxKeys(1), OnLimitExceeded(RejectOverLimit))
+	assert.Error(err)
+	h = l.Health()
+	assert.False(h.Healthy)
+	assert.False(h.Loaded)
+	assert.Equal(err, h.LastError)
+	assert.Equal([]string{"no snapshot has been loaded"}, h.Failures)
+}
+
+// stoppingSource stops watching as soon as it starts.
+type stoppingSource struct{}
+
+func (stoppingSource) Keys() ([]string, error) { return []string{"key"}, nil }
+func (stoppingSource) Get(key string) (*entry.Entry, error) {
+	return entry.New("value", time.Time{}), nil
+}
+func (stoppingSource) Watch(stop <-chan struct{}, changed func()) error {
+	return errors.New("connection lost")
+}
+
+func TestHealthWatchStopped(t *testing.T) {
+	assert := require.New(t)
+
+	loader, err := NewFromSource(stoppingSource{}, nullScope, WithLogger(NopLogger))
+	assert.NoError(err)
+	defer loader.(*Loader).Close()
+	l := loader.(*Loader)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for l.Health().Watching && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	h := l.Health()
+	assert.False(h.Healthy)
+	assert.False(h.Watching)
+	assert.Empty(h.Path)
+	assert.Equal([]string{"stopped watching for changes"}, h.Failures)
+}
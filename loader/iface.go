@@ -8,7 +8,8 @@ type IFace interface {
 	Snapshot() snapshot.IFace
 
 	// Add a channel that will be written to when a new snapshot is available. "1" will be written
-	// to the channel as a sentinel.
+	// to the channel as a sentinel. *Loader also offers Subscribe, which delivers the snapshots
+	// themselves and can be unsubscribed.
 	// @param callback supplies the callback to add.
 	AddUpdateCallback(callback chan<- int)
 }
@@ -0,0 +1,58 @@
+package loader
+
+import (
+	"path"
+	"strings"
+)
+
+// A KeyMapper derives a runtime key from the path of a runtime file. path is
+// slash separated and relative to the runtime subdirectory.
+type KeyMapper func(path string) string
+
+// DotJoinKeys joins path segments with ".", so "dir/file" becomes "dir.file".
+// It is the default.
+func DotJoinKeys(path string) string { return strings.Replace(path, "/", ".", -1) }
+
+// SlashKeys keeps path segments joined with "/", so "dir/file.b" and
+// "dir/file/b" remain distinct keys.
+func SlashKeys(path string) string { return path }
+
+// StripExtension removes the extension of the file name, so "dir/file.json"
+// becomes "dir/file". Dotfiles without another extension are left as is.
+func StripExtension(p string) string {
+	ext := path.Ext(p)
+	if ext == path.Base(p) {
+		return p
+	}
+	return strings.TrimSuffix(p, ext)
+}
+
+// LowercaseKeys lowercases the whole path.
+func LowercaseKeys(path string) string { return strings.ToLower(path) }
+
+// ComposeKeyMappers returns a KeyMapper applying mappers in order. Mappers
+// that join segments, like DotJoinKeys, usually come last:
+//
+//	ComposeKeyMappers(StripExtension, LowercaseKeys, DotJoinKeys)
+func ComposeKeyMappers(mappers ...KeyMapper) KeyMapper {
+	return func(path string) string {
+		for _, m := range mappers {
+			path = m(path)
+		}
+		return path
+	}
+}
+
+// WithKeyMapper sets how runtime keys are derived from file paths. When several
+// files map to the same key, the last one in walk order is loaded, as without a
+// mapper, and the collision is reported in the stats and the loader's Status.
+func WithKeyMapper(m KeyMapper) Option {
+	return func(l *Loader) { l.keyMapper = m }
+}
+
+func (l *Loader) mapKey(path string) string {
+	if l.keyMapper == nil {
+		return DotJoinKeys(path)
+	}
+	return l.keyMapper(path)
+}
@@ -0,0 +1,64 @@
+package loader
+
+import (
+	"io/ioutil"
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyMappers(t *testing.T) {
+	assert := require.New(t)
+
+	assert.Equal("dir.file.json", DotJoinKeys("dir/file.json"))
+	assert.Equal("dir/file.json", SlashKeys("dir/file.json"))
+	assert.Equal("dir.v2/file", StripExtension("dir.v2/file.json"))
+	assert.Equal("dir.v2/file", StripExtension("dir.v2/file"))
+	assert.Equal("dir/.file", StripExtension("dir/.file"))
+	assert.Equal("dir/.file", StripExtension("dir/.file.yaml"))
+	assert.Equal("dir/file", LowercaseKeys("Dir/FILE"))
+
+	mapper := ComposeKeyMappers(StripExtension, LowercaseKeys, DotJoinKeys)
+	assert.Equal("dir.file", mapper("Dir/File.TXT"))
+}
+
+func TestKeyCollisions(t *testing.T) {
+	assert := require.New(t)
+
+	tempDir, err := ioutil.TempDir("", "key_mapper_test")
+	assert.NoError(err)
+	defer os.RemoveAll(tempDir)
+
+	makeFileInDir(assert, tempDir+"/app/c/a.b", "file")
+	makeFileInDir(assert, tempDir+"/app/c/a/b", "nested")
+	makeFileInDir(assert, tempDir+"/app/d/e.txt", "text")
+
+	loader, err := New2(tempDir, "app", nullScope, &DirectoryRefresher{}, AllowDotFiles)
+	assert.NoError(err)
+	defer loader.(*Loader).Close()
+	// The last file walked wins, as it always has.
+	assert.Equal("file", loader.Snapshot().Get("c.a.b"))
+	status := loader.(*Loader).Status()
+	assert.Equal(2, status.NumValues)
+	assert.Equal([]KeyCollision{{
+		Key:   "c.a.b",
+		Paths: []string{tempDir + "/app/c/a/b", tempDir + "/app/c/a.b"},
+	}}, status.KeyCollisions)
+
+	loader, err = New2(tempDir, "app", nullScope, &DirectoryRefresher{}, AllowDotFiles, WithKeyMapper(SlashKeys))
+	assert.NoError(err)
+	defer loader.(*Loader).Close()
+	keys := loader.Snapshot().Keys()
+	sort.Strings(keys)
+	assert.Equal([]string{"c/a.b", "c/a/b", "d/e.txt"}, keys)
+	assert.Empty(loader.(*Loader).Status().KeyCollisions)
+
+	loader, err = New2(tempDir, "app", nullScope, &DirectoryRefresher{}, AllowDotFiles,
+		WithKeyMapper(ComposeKeyMappers(StripExtension, DotJoinKeys)))
+	assert.NoError(err)
+	defer loader.(*Loader).Close()
+	assert.Equal("text", loader.Snapshot().Get("d.e"))
+	assert.Equal("file", loader.Snapshot().Get("c.a"))
+}
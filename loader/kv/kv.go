@@ -0,0 +1,247 @@
+// Package kv adapts watchable key-value stores such as etcd or Consul into a
+// loader.Source, so runtime can be served from a KV store instead of disk.
+package kv
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lyft/goruntime/loader"
+	"github.com/lyft/goruntime/snapshot/entry"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RevisionMetadataKey is the snapshot metadata key holding the store revision
+// a snapshot was built from.
+const RevisionMetadataKey = "kv.revision"
+
+// KeyValue is a single key stored in a Client.
+type KeyValue struct {
+	Key   string
+	Value []byte
+	// ModRevision is the store revision at which the key was last modified.
+	ModRevision int64
+}
+
+// WatchResponse reports that the keys under a watched prefix changed.
+type WatchResponse struct {
+	// Revision is the store revision after the change.
+	Revision int64
+	// Err is set if the watch failed. The channel is closed after an error.
+	Err error
+}
+
+// Client is the subset of an etcd or Consul style API needed by Source.
+// Implementations must be safe for concurrent use.
+type Client interface {
+	// List returns every key under prefix and the store revision the listing reflects.
+	List(ctx context.Context, prefix string) ([]KeyValue, int64, error)
+
+	// Watch reports every change to keys under prefix made after revision. The
+	// returned channel is closed when ctx is done or the watch fails.
+	Watch(ctx context.Context, prefix string, revision int64) <-chan WatchResponse
+}
+
+// Default retry backoff used when a watch fails.
+const (
+	DefaultMinBackoff = 100 * time.Millisecond
+	DefaultMaxBackoff = 30 * time.Second
+)
+
+// Source is a loader.Source backed by a Client. Keys below Prefix are mapped
+// to runtime keys by stripping the prefix and joining the remaining path
+// segments with ".", so "/runtime/app/foo/bar" under "/runtime/app/" becomes
+// "foo.bar".
+type Source struct {
+	client    Client
+	prefix    string
+	separator string
+
+	// MinBackoff and MaxBackoff bound the delay before re-establishing a failed watch.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// Timeout bounds each List call. Zero means no timeout.
+	Timeout time.Duration
+
+	mu       sync.Mutex
+	revision int64
+	entries  map[string]*entry.Entry
+	// modRevisions remembers the revision each key was last seen modified at,
+	// so entries keep their Modified time until the key actually changes.
+	modRevisions map[string]int64
+
+	logger loader.Logger
+}
+
+// NewSource creates a Source that serves the keys stored below prefix, using
+// "/" as the path separator.
+func NewSource(client Client, prefix string) *Source {
+	return NewSourceWithSeparator(client, prefix, "/")
+}
+
+// NewSourceWithSeparator is like NewSource but splits store keys on separator.
+func NewSourceWithSeparator(client Client, prefix string, separator string) *Source {
+	return &Source{
+		client:     client,
+		prefix:     prefix,
+		separator:  separator,
+		MinBackoff: DefaultMinBackoff,
+		MaxBackoff: DefaultMaxBackoff,
+		logger:     loader.NewLogrusLogger(logrus.StandardLogger()),
+	}
+}
+
+// SetLogger implements loader.LoggerSetter, so the source logs through the
+// Logger of the loader it is passed to. It must be called before the source
+// is used.
+func (s *Source) SetLogger(logger loader.Logger) { s.logger = logger }
+
+// RuntimeKey maps a store key to a runtime key. ok is false for keys outside
+// the prefix and for directory placeholders.
+func (s *Source) RuntimeKey(storeKey string) (key string, ok bool) {
+	if !strings.HasPrefix(storeKey, s.prefix) {
+		return "", false
+	}
+	rel := strings.Trim(strings.TrimPrefix(storeKey, s.prefix), s.separator)
+	// Consul stores folders as keys ending in the separator.
+	if rel == "" || strings.HasSuffix(storeKey, s.separator) {
+		return "", false
+	}
+	return strings.Replace(rel, s.separator, ".", -1), true
+}
+
+func (s *Source) Keys() ([]string, error) {
+	ctx := context.Background()
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+
+	kvs, revision, err := s.client.List(ctx, s.prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := make(map[string]*entry.Entry, len(kvs))
+	modRevisions := make(map[string]int64, len(kvs))
+	keys := make([]string, 0, len(kvs))
+	for _, kv := range kvs {
+		key, ok := s.RuntimeKey(kv.Key)
+		if !ok {
+			continue
+		}
+		if _, dup := entries[key]; dup {
+			s.logger.Warn("runtime: store key maps to duplicate key, ignoring",
+				loader.Field{Key: "store_key", Value: kv.Key}, loader.Field{Key: loader.FieldKey, Value: key})
+			continue
+		}
+
+		e := entry.New(string(kv.Value), now)
+		if prev, ok := s.entries[key]; ok && s.modRevisions[key] == kv.ModRevision {
+			e.Modified = prev.Modified
+		}
+
+		entries[key] = e
+		modRevisions[key] = kv.ModRevision
+		keys = append(keys, key)
+	}
+
+	s.entries = entries
+	s.modRevisions = modRevisions
+	s.revision = revision
+	return keys, nil
+}
+
+func (s *Source) Get(key string) (*entry.Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return e, nil
+}
+
+func (s *Source) Metadata() map[string]string {
+	return map[string]string{RevisionMetadataKey: strconv.FormatInt(s.Revision(), 10)}
+}
+
+// Revision returns the store revision of the last successful listing.
+func (s *Source) Revision() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.revision
+}
+
+var errWatchClosed = errors.New("goruntime/kv: watch closed")
+
+func (s *Source) Watch(stop <-chan struct{}, changed func()) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	backoff := s.MinBackoff
+	for {
+		err := s.watchOnce(ctx, changed)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err == nil {
+			// The watch made progress before ending, so start backing off afresh.
+			backoff = s.MinBackoff
+			err = errWatchClosed
+		}
+		s.logger.Warn("runtime: kv watch failed, retrying", loader.Field{Key: "prefix", Value: s.prefix},
+			loader.Field{Key: "backoff", Value: backoff.String()}, loader.Field{Key: loader.FieldError, Value: err})
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+
+		// Changes made while the watch was down are picked up by a full reload.
+		changed()
+
+		if backoff *= 2; backoff > s.MaxBackoff {
+			backoff = s.MaxBackoff
+		}
+	}
+}
+
+// watchOnce runs a single watch until it ends. It returns nil if at least one
+// change was delivered and the watch then closed, or the error that ended it.
+func (s *Source) watchOnce(ctx context.Context, changed func()) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var err error = errWatchClosed
+	for resp := range s.client.Watch(ctx, s.prefix, s.Revision()) {
+		if resp.Err != nil {
+			return resp.Err
+		}
+		err = nil
+		if resp.Revision > s.Revision() {
+			changed()
+		}
+	}
+	return err
+}
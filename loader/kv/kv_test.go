@@ -0,0 +1,180 @@
+package kv_test
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lyft/goruntime/loader"
+	"github.com/lyft/goruntime/loader/kv"
+	"github.com/lyft/goruntime/loader/kv/kvtest"
+	"github.com/lyft/goruntime/snapshot"
+	stats "github.com/lyft/gostats"
+	"github.com/stretchr/testify/require"
+)
+
+var nullScope = stats.NewStore(stats.NewNullSink(), false)
+
+const timeout = 3 * time.Second
+
+func waitForUpdate(t *testing.T, update <-chan int) {
+	select {
+	case <-update:
+	case <-time.After(timeout):
+		t.Fatalf("no update after %s", timeout)
+	}
+}
+
+func TestSource_RuntimeKey(t *testing.T) {
+	assert := require.New(t)
+
+	source := kv.NewSource(kvtest.NewServer(), "/runtime/app/")
+	key, ok := source.RuntimeKey("/runtime/app/foo/bar")
+	assert.True(ok)
+	assert.Equal("foo.bar", key)
+
+	_, ok = source.RuntimeKey("/runtime/app/")
+	assert.False(ok)
+	_, ok = source.RuntimeKey("/runtime/app/folder/")
+	assert.False(ok)
+	_, ok = source.RuntimeKey("/runtime/other/foo")
+	assert.False(ok)
+
+	source = kv.NewSourceWithSeparator(kvtest.NewServer(), "runtime:app:", ":")
+	key, ok = source.RuntimeKey("runtime:app:foo:bar")
+	assert.True(ok)
+	assert.Equal("foo.bar", key)
+}
+
+func TestSource_Loader(t *testing.T) {
+	assert := require.New(t)
+
+	server := kvtest.NewServer()
+	server.Put("/runtime/app/file1", "hello")
+	server.Put("/runtime/app/dir/file2", " 34\n")
+	server.Put("/runtime/other/file3", "ignored")
+
+	source := kv.NewSource(server, "/runtime/app/")
+	source.MinBackoff = time.Millisecond
+	l, err := loader.NewFromSource(source, nullScope)
+	assert.NoError(err)
+	defer l.(*loader.Loader).Close()
+	update := make(chan int, 1)
+	l.AddUpdateCallback(update)
+
+	s := l.Snapshot()
+	keys := s.Keys()
+	sort.Strings(keys)
+	assert.Equal([]string{"dir.file2", "file1"}, keys)
+	assert.Equal("hello", s.Get("file1"))
+	assert.Equal(uint64(34), s.GetInteger("dir.file2", 0))
+	assert.Equal(strconv.FormatInt(source.Revision(), 10), snapshot.Metadata(s)[kv.RevisionMetadataKey])
+	modified := s.GetModified("dir.file2")
+
+	revision := server.Put("/runtime/app/file1", "hello2")
+	waitForUpdate(t, update)
+	s = l.Snapshot()
+	assert.Equal("hello2", s.Get("file1"))
+	assert.Equal(modified, s.GetModified("dir.file2"))
+	assert.Equal(strconv.FormatInt(revision, 10), snapshot.Metadata(s)[kv.RevisionMetadataKey])
+
+	server.Delete("/runtime/app/dir/file2")
+	waitForUpdate(t, update)
+	assert.Equal([]string{"file1"}, l.Snapshot().Keys())
+
+	// Changes to other prefixes do not trigger reloads.
+	server.Put("/runtime/other/file3", "still ignored")
+	select {
+	case <-update:
+		t.Fatal("unexpected update")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// A failed reload keeps the current snapshot.
+	server.SetListError(errors.New("unavailable"))
+	server.Put("/runtime/app/file1", "hello3")
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal("hello2", l.Snapshot().Get("file1"))
+	server.SetListError(nil)
+
+	// Dropped watches are re-established and changes made meanwhile are loaded.
+	server.FailWatches(errors.New("connection reset"))
+	server.Put("/runtime/app/file4", "new")
+	deadline := time.Now().Add(timeout)
+	for l.Snapshot().Get("file4") != "new" {
+		if time.Now().After(deadline) {
+			t.Fatal("watch was not re-established")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal("hello3", l.Snapshot().Get("file1"))
+}
+
+func TestSource_InitialListError(t *testing.T) {
+	server := kvtest.NewServer()
+	server.SetListError(errors.New("unavailable"))
+
+	_, err := loader.NewFromSource(kv.NewSource(server, "/runtime/"), nullScope)
+	require.Error(t, err)
+}
+
+func TestSource_Stop(t *testing.T) {
+	server := kvtest.NewServer()
+	source := kv.NewSource(server, "/runtime/")
+
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() { done <- source.Watch(stop, func() {}) }()
+
+	deadline := time.Now().Add(timeout)
+	for server.Watchers() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("watch not started")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(stop)
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(timeout):
+		t.Fatal("watch did not stop")
+	}
+}
+
+// warnings records the messages of the warnings logged to it.
+type warnings struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (w *warnings) Debug(msg string, fields ...loader.Field) {}
+func (w *warnings) Info(msg string, fields ...loader.Field)  {}
+func (w *warnings) Error(msg string, fields ...loader.Field) {}
+
+func (w *warnings) Warn(msg string, fields ...loader.Field) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.messages = append(w.messages, msg)
+}
+
+func TestSource_LoaderLogger(t *testing.T) {
+	assert := require.New(t)
+
+	server := kvtest.NewServer()
+	server.Put("/runtime/app/a/b", "first")
+	server.Put("/runtime/app/a.b", "second")
+
+	logs := &warnings{}
+	l, err := loader.NewFromSource(kv.NewSource(server, "/runtime/app/"), nullScope, loader.WithLogger(logs))
+	assert.NoError(err)
+	defer l.(*loader.Loader).Close()
+
+	logs.mu.Lock()
+	defer logs.mu.Unlock()
+	assert.Equal([]string{"runtime: store key maps to duplicate key, ignoring"}, logs.messages)
+}
@@ -0,0 +1,193 @@
+// Package kvtest provides an in-process key-value server implementing
+// kv.Client, for testing runtime loaders without a real etcd or Consul.
+package kvtest
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/lyft/goruntime/loader/kv"
+)
+
+// Server is an in-memory, revisioned key-value store with etcd style watches.
+// The zero value is not usable; create servers with NewServer.
+type Server struct {
+	mu       sync.Mutex
+	revision int64
+	data     map[string]kv.KeyValue
+	// deleted records the revision at which each deleted key was removed, so
+	// watches started from an older revision still observe the deletion.
+	deleted  map[string]int64
+	watchers map[*watcher]struct{}
+	listErr  error
+}
+
+type watcher struct {
+	prefix string
+	notify chan struct{}
+	fail   chan error
+}
+
+// NewServer creates an empty server at revision 1.
+func NewServer() *Server {
+	return &Server{
+		revision: 1,
+		data:     map[string]kv.KeyValue{},
+		deleted:  map[string]int64{},
+		watchers: map[*watcher]struct{}{},
+	}
+}
+
+// Put stores value under key and returns the new store revision.
+func (s *Server) Put(key string, value string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revision++
+	s.data[key] = kv.KeyValue{Key: key, Value: []byte(value), ModRevision: s.revision}
+	delete(s.deleted, key)
+	s.notifyLocked(key)
+	return s.revision
+}
+
+// Delete removes key and returns the new store revision.
+func (s *Server) Delete(key string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.data[key]; !ok {
+		return s.revision
+	}
+	s.revision++
+	delete(s.data, key)
+	s.deleted[key] = s.revision
+	s.notifyLocked(key)
+	return s.revision
+}
+
+// SetListError makes every subsequent List call fail with err, or succeed again if err is nil.
+func (s *Server) SetListError(err error) {
+	s.mu.Lock()
+	s.listErr = err
+	s.mu.Unlock()
+}
+
+// FailWatches ends every active watch with err, as a dropped connection would.
+func (s *Server) FailWatches(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for w := range s.watchers {
+		w.fail <- err
+		delete(s.watchers, w)
+	}
+}
+
+// Watchers returns the number of active watches.
+func (s *Server) Watchers() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.watchers)
+}
+
+func (s *Server) List(ctx context.Context, prefix string) ([]kv.KeyValue, int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.listErr != nil {
+		return nil, 0, s.listErr
+	}
+
+	var kvs []kv.KeyValue
+	for key, value := range s.data {
+		if strings.HasPrefix(key, prefix) {
+			kvs = append(kvs, value)
+		}
+	}
+	sort.Slice(kvs, func(i, j int) bool { return kvs[i].Key < kvs[j].Key })
+	return kvs, s.revision, nil
+}
+
+func (s *Server) Watch(ctx context.Context, prefix string, revision int64) <-chan kv.WatchResponse {
+	w := &watcher{
+		prefix: prefix,
+		notify: make(chan struct{}, 1),
+		fail:   make(chan error, 1),
+	}
+
+	s.mu.Lock()
+	s.watchers[w] = struct{}{}
+	if s.changedSinceLocked(prefix, revision) {
+		w.notify <- struct{}{}
+	}
+	s.mu.Unlock()
+
+	out := make(chan kv.WatchResponse)
+	go func() {
+		defer close(out)
+		defer func() {
+			s.mu.Lock()
+			delete(s.watchers, w)
+			s.mu.Unlock()
+		}()
+
+		for {
+			var resp kv.WatchResponse
+			select {
+			case <-ctx.Done():
+				return
+			case err := <-w.fail:
+				resp.Err = err
+			case <-w.notify:
+				s.mu.Lock()
+				resp.Revision = s.revision
+				s.mu.Unlock()
+			}
+
+			select {
+			case out <- resp:
+			case <-ctx.Done():
+				return
+			}
+			if resp.Err != nil {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+func (s *Server) changedSinceLocked(prefix string, revision int64) bool {
+	for key, value := range s.data {
+		if strings.HasPrefix(key, prefix) && value.ModRevision > revision {
+			return true
+		}
+	}
+	for key, deletedAt := range s.deleted {
+		if strings.HasPrefix(key, prefix) && deletedAt > revision {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) notifyLocked(key string) {
+	for w := range s.watchers {
+		if !strings.HasPrefix(key, w.prefix) {
+			continue
+		}
+		select {
+		case w.notify <- struct{}{}:
+		default:
+			// A notification is already pending and will report the latest revision.
+		}
+	}
+}
+
+var _ kv.Client = (*Server)(nil)
@@ -0,0 +1,132 @@
+package loader
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// Names of the limits reported in a LimitViolation.
+const (
+	FileSizeLimit     = "file_size"
+	SnapshotSizeLimit = "snapshot_size"
+	KeyCountLimit     = "keys"
+)
+
+// LimitAction is what the loader does when a file exceeds a limit set with
+// MaxFileSize, MaxSnapshotSize or MaxKeys.
+type LimitAction int
+
+const (
+	// SkipOverLimit skips files that exceed a limit and loads the rest. It is
+	// the default.
+	SkipOverLimit LimitAction = iota
+	// RejectOverLimit rejects the whole reload, keeping the current snapshot.
+	RejectOverLimit
+)
+
+// LimitViolation describes a file that exceeded a loader limit.
+type LimitViolation struct {
+	// Limit is one of FileSizeLimit, SnapshotSizeLimit or KeyCountLimit.
+	Limit string
+	Path  string
+	// Max is the configured limit.
+	Max int64
+}
+
+func (v *LimitViolation) Error() string {
+	return fmt.Sprintf("runtime: %s exceeds the %s limit of %d", v.Path, v.Limit, v.Max)
+}
+
+// MaxFileSize limits the size in bytes of any single runtime file. Files are
+// never read past the limit, and with GitRef blobs over it are never inflated,
+// so an oversized file cannot exhaust memory.
+func MaxFileSize(bytes int64) Option {
+	return func(l *Loader) { l.maxFileSize = bytes }
+}
+
+// MaxSnapshotSize limits the combined size in bytes of all values in a snapshot.
+func MaxSnapshotSize(bytes int64) Option {
+	return func(l *Loader) { l.maxSnapshotSize = bytes }
+}
+
+// MaxKeys limits the number of keys in a snapshot.
+func MaxKeys(n int) Option {
+	return func(l *Loader) { l.maxKeys = n }
+}
+
+// OnLimitExceeded sets what happens when a limit is exceeded. Every violation
+// is counted and listed in the loader's Status either way.
+func OnLimitExceeded(action LimitAction) Option {
+	return func(l *Loader) { l.limitAction = action }
+}
+
+// readFile reads path, stopping as soon as it is known to exceed MaxFileSize.
+func (s *fileSource) readFile(path string) ([]byte, *LimitViolation, error) {
+	max := s.loader.maxFileSize
+	if max <= 0 {
+		contents, err := ioutil.ReadFile(path)
+		return contents, nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	contents, err := ioutil.ReadAll(io.LimitReader(f, max+1))
+	if err != nil {
+		return nil, nil, err
+	}
+	if int64(len(contents)) > max {
+		return nil, &LimitViolation{Limit: FileSizeLimit, Path: path, Max: max}, nil
+	}
+	return contents, nil, nil
+}
+
+// checkLimits reports whether setting key to a value of size bytes from path
+// would exceed the key count or snapshot size limits. Keys are counted after
+// mapping, so a file that collides with an earlier one adds no key, and its
+// value replaces the earlier one in the snapshot size.
+func (s *fileSource) checkLimits(path string, key string, size int64) *LimitViolation {
+	l := s.loader
+	if max := l.maxFileSize; max > 0 && size > max {
+		return &LimitViolation{Limit: FileSizeLimit, Path: path, Max: max}
+	}
+	_, replaces := s.paths[key]
+	if max := l.maxKeys; max > 0 && !replaces && len(s.paths) >= max {
+		return &LimitViolation{Limit: KeyCountLimit, Path: path, Max: int64(max)}
+	}
+	current := s.size
+	if replaces {
+		current -= int64(len(s.values[key].contents))
+	}
+	if max := l.maxSnapshotSize; max > 0 && current+size > max {
+		return &LimitViolation{Limit: SnapshotSizeLimit, Path: path, Max: max}
+	}
+	return nil
+}
+
+// limitExceeded records v and returns the error that should end the walk, or
+// nil if only the offending file is skipped.
+func (s *fileSource) limitExceeded(v *LimitViolation) error {
+	l := s.loader
+	switch v.Limit {
+	case FileSizeLimit:
+		l.stats.fileSizeLimitExceeded.Inc()
+	case SnapshotSizeLimit:
+		l.stats.snapshotSizeLimitExceeded.Inc()
+	case KeyCountLimit:
+		l.stats.keyLimitExceeded.Inc()
+	}
+	l.pending.LimitViolations = append(l.pending.LimitViolations, *v)
+
+	if l.limitAction == RejectOverLimit {
+		l.log().Warn("runtime: limit exceeded, rejecting reload", pathField(v.Path), errorField(v))
+		return v
+	}
+	l.log().Warn("runtime: limit exceeded, skipping file", pathField(v.Path), errorField(v))
+	return nil
+}
@@ -0,0 +1,111 @@
+package loader
+
+import (
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	stats "github.com/lyft/gostats"
+	"github.com/lyft/gostats/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimits(t *testing.T) {
+	assert := require.New(t)
+
+	tempDir, err := ioutil.TempDir("", "limits_test")
+	assert.NoError(err)
+	defer os.RemoveAll(tempDir)
+
+	makeFileInDir(assert, tempDir+"/app/a", "12345")
+	makeFileInDir(assert, tempDir+"/app/b", strings.Repeat("x", 100))
+	makeFileInDir(assert, tempDir+"/app/c", "123")
+	makeFileInDir(assert, tempDir+"/app/d", "1")
+
+	load := func(opts ...Option) (*Loader, []string) {
+		loader, err := New2(tempDir, "app", nullScope, &DirectoryRefresher{}, opts...)
+		assert.NoError(err)
+		defer loader.(*Loader).Close()
+		keys := loader.Snapshot().Keys()
+		sort.Strings(keys)
+		return loader.(*Loader), keys
+	}
+
+	loader, keys := load(MaxFileSize(10))
+	assert.Equal([]string{"a", "c", "d"}, keys)
+	assert.Equal([]LimitViolation{{Limit: FileSizeLimit, Path: tempDir + "/app/b", Max: 10}}, loader.Status().LimitViolations)
+	assert.NoError(loader.Status().LastError)
+
+	_, keys = load(MaxKeys(2))
+	assert.Equal([]string{"a", "b"}, keys)
+
+	loader, keys = load(MaxSnapshotSize(9))
+	assert.Equal([]string{"a", "c", "d"}, keys)
+	assert.Len(loader.Status().LimitViolations, 1)
+	assert.Equal(SnapshotSizeLimit, loader.Status().LimitViolations[0].Limit)
+
+	// A rejected initial load publishes an empty snapshot rather than a partial one.
+	loader, keys = load(MaxFileSize(10), OnLimitExceeded(RejectOverLimit))
+	assert.Empty(keys)
+	assert.IsType(&LimitViolation{}, loader.Status().LastError)
+}
+
+func TestLimitsCountMappedKeys(t *testing.T) {
+	assert := require.New(t)
+
+	tempDir, err := ioutil.TempDir("", "limits_test")
+	assert.NoError(err)
+	defer os.RemoveAll(tempDir)
+
+	// Three files, but c/a/b and c/a.b both map to c.a.b, so c/a.b is walked
+	// when there are already two keys yet adds none, and its value replaces
+	// that of c/a/b in the snapshot size.
+	makeFileInDir(assert, tempDir+"/app/a", "1")
+	makeFileInDir(assert, tempDir+"/app/c/a/b", "nested")
+	makeFileInDir(assert, tempDir+"/app/c/a.b", "file")
+
+	loader, err := New2(tempDir, "app", nullScope, &manualRefresher{}, WithLogger(NopLogger),
+		MaxKeys(2), MaxSnapshotSize(7), OnLimitExceeded(RejectOverLimit))
+	assert.NoError(err)
+	defer loader.(*Loader).Close()
+	status := loader.(*Loader).Status()
+	assert.NoError(status.LastError)
+	assert.Empty(status.LimitViolations)
+	assert.Equal(2, status.NumValues)
+	assert.Equal("file", loader.Snapshot().Get("c.a.b"))
+}
+
+func TestLimitsRejectKeepsSnapshot(t *testing.T) {
+	assert := require.New(t)
+
+	tempDir, err := ioutil.TempDir("", "limits_test")
+	assert.NoError(err)
+	defer os.RemoveAll(tempDir)
+
+	makeFileInDir(assert, tempDir+"/app/a", "12345")
+
+	sink := mock.NewSink()
+	store := stats.NewStore(sink, false)
+	loader, err := New2(tempDir, "app", store.Scope("runtime"), &manualRefresher{}, MaxKeys(1), OnLimitExceeded(RejectOverLimit))
+	assert.NoError(err)
+	defer loader.(*Loader).Close()
+	runtime_update := make(chan int)
+	loader.AddUpdateCallback(runtime_update)
+	assert.Equal("12345", loader.Snapshot().Get("a"))
+
+	makeFileInDir(assert, tempDir+"/app/b", "too many")
+	makeFileInDir(assert, tempDir+"/app/a", "updated")
+	l := loader.(*Loader)
+	l.onRuntimeChanged()
+
+	assert.Equal("12345", l.Snapshot().Get("a"))
+	status := l.Status()
+	assert.Equal(1, status.NumValues)
+	assert.Equal(&LimitViolation{Limit: KeyCountLimit, Path: tempDir + "/app/b", Max: 1}, status.LastError)
+
+	store.Flush()
+	sink.AssertCounterEquals(t, "runtime.key_limit_exceeded", 1)
+	sink.AssertCounterEquals(t, "runtime.load_rejections", 1)
+}
@@ -1,37 +1,113 @@
 package loader
 
 import (
+	"context"
 	"fmt"
-	"io/ioutil"
 	"os"
-	"path/filepath"
-	"strconv"
-	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
+	"github.com/lyft/goruntime/schema"
 	"github.com/lyft/goruntime/snapshot"
-	"github.com/lyft/goruntime/snapshot/entry"
 	stats "github.com/lyft/gostats"
 
 	logger "github.com/sirupsen/logrus"
 )
 
 type loaderStats struct {
-	loadAttempts stats.Counter
-	loadFailures stats.Counter
-	numValues    stats.Gauge
+	// The counters reported by LoadStats also keep their totals.
+	loadAttempts  *totalCounter
+	loadFailures  *totalCounter
+	numValues     stats.Gauge
+	keyCollisions *totalCounter
+
+	fileSizeLimitExceeded     stats.Counter
+	snapshotSizeLimitExceeded stats.Counter
+	keyLimitExceeded          stats.Counter
+	loadRejections            *totalCounter
+	pathViolations            stats.Counter
+	validationErrors          stats.Counter
+
+	// Errors that skipped a file, or failed a reload, by class. Each is also
+	// counted in loadFailures.
+	readErrors       stats.Counter
+	permissionErrors stats.Counter
+	parseErrors      stats.Counter
+	pathErrors       stats.Counter
+
+	// The phases of a reload: listing the keys, which for the file source
+	// reads every file; parsing the values into entries and validating them;
+	// and publishing the snapshot.
+	walkTime           stats.Timer
+	parseTime          stats.Timer
+	publishTime        stats.Timer
+	secondsSinceReload stats.Gauge
+	watchErrors        stats.Counter
+	watchRecoveries    stats.Counter
+	callbacksDropped   stats.Counter
+	subscriberPanics   stats.Counter
 }
 
 func newLoaderStats(scope stats.Scope) loaderStats {
 	ret := loaderStats{}
-	ret.loadAttempts = scope.NewCounter("load_attempts")
-	ret.loadFailures = scope.NewCounter("load_failures")
+	ret.loadAttempts = newTotalCounter(scope.NewCounter("load_attempts"))
+	ret.loadFailures = newTotalCounter(scope.NewCounter("load_failures"))
 	ret.numValues = scope.NewGauge("num_values")
+	ret.keyCollisions = newTotalCounter(scope.NewCounter("key_collisions"))
+	ret.fileSizeLimitExceeded = scope.NewCounter("file_size_limit_exceeded")
+	ret.snapshotSizeLimitExceeded = scope.NewCounter("snapshot_size_limit_exceeded")
+	ret.keyLimitExceeded = scope.NewCounter("key_limit_exceeded")
+	ret.loadRejections = newTotalCounter(scope.NewCounter("load_rejections"))
+	ret.pathViolations = scope.NewCounter("path_violations")
+	ret.validationErrors = scope.NewCounter("validation_errors")
+	ret.readErrors = scope.NewCounter("read_errors")
+	ret.permissionErrors = scope.NewCounter("permission_errors")
+	ret.parseErrors = scope.NewCounter("parse_errors")
+	ret.pathErrors = scope.NewCounter("path_errors")
+	ret.walkTime = scope.NewTimer("walk_time")
+	ret.parseTime = scope.NewTimer("parse_time")
+	ret.publishTime = scope.NewTimer("publish_time")
+	ret.secondsSinceReload = scope.NewGauge("seconds_since_reload")
+	ret.watchErrors = scope.NewCounter("watch_errors")
+	ret.watchRecoveries = scope.NewCounter("watch_recoveries")
+	ret.callbacksDropped = scope.NewCounter("callbacks_dropped")
+	ret.subscriberPanics = scope.NewCounter("subscriber_panics")
 	return ret
 }
 
+// totalCounter is a Counter that also keeps its total since it was created,
+// which flushing the stats store does not reset.
+type totalCounter struct {
+	// total is accessed atomically and kept first for 64-bit alignment.
+	total uint64
+	stats.Counter
+}
+
+func newTotalCounter(c stats.Counter) *totalCounter {
+	return &totalCounter{Counter: c}
+}
+
+func (c *totalCounter) Add(n uint64) {
+	atomic.AddUint64(&c.total, n)
+	c.Counter.Add(n)
+}
+
+func (c *totalCounter) Inc() { c.Add(1) }
+
+func (c *totalCounter) Total() uint64 { return atomic.LoadUint64(&c.total) }
+
+// readError returns the counter for err, an error reading a runtime file or
+// listing keys: permission_errors if it was for lack of permission and
+// read_errors otherwise.
+func (s *loaderStats) readError(err error) stats.Counter {
+	if os.IsPermission(err) {
+		return s.permissionErrors
+	}
+	return s.readErrors
+}
+
 type callbacks struct {
 	mu  sync.Mutex
 	cbs []chan<- struct{}
@@ -64,8 +140,10 @@ func (c *callbacks) Add(callback chan<- int) {
 	go notifyCallback(notify, callback)
 }
 
-// Signal all callback channels without blocking.
-func (c *callbacks) Signal() {
+// Signal all callback channels without blocking. It returns the number of
+// signals dropped because a callback had not yet received the previous one.
+func (c *callbacks) Signal() int {
+	dropped := 0
 	c.mu.Lock()
 	for _, ch := range c.cbs {
 		select {
@@ -74,22 +152,56 @@ func (c *callbacks) Signal() {
 		default:
 			// We're still waiting for a previous signal to be sent, dropping
 			// this signal.
+			dropped++
 		}
 	}
 	c.mu.Unlock()
+	return dropped
 }
 
-// Implementation of Loader that watches a symlink and reads from the filesystem.
+// Implementation of Loader that builds snapshots from a Source. Loaders created
+// with New2 watch a symlink or directory and read from the filesystem.
 type Loader struct {
-	currentSnapshot atomic.Value
-	watcher         *fsnotify.Watcher
-	watchPath       string
-	subdirectory    string
-	nextSnapshot    snapshot.IFace
-	callbacks       callbacks
-	mu              sync.Mutex
-	stats           loaderStats
-	ignoreDotfiles  bool
+	// generation is accessed atomically and kept first for 64-bit alignment.
+	generation       uint64
+	currentSnapshot  atomic.Value
+	source           Source
+	watchPath        string
+	subdirectory     string
+	callbacks        callbacks
+	subscriptions    subscriptions
+	mu               sync.Mutex
+	stats            loaderStats
+	ignoreDotfiles   bool
+	trackGitRevision bool
+	gitRef           string
+	configMapLayout  bool
+	keyMapper        KeyMapper
+	maxFileSize      int64
+	maxSnapshotSize  int64
+	maxKeys          int
+	limitAction      LimitAction
+	confineToRoot    bool
+	allowedPaths     []string
+	schema           *schema.Schema
+	logger           Logger
+	healthThresholds HealthThresholds
+	// waitCtx is set by WaitForInitialLoad.
+	waitCtx context.Context
+	// ready is closed once the loader first publishes a ready snapshot.
+	readyMu sync.Mutex
+	ready   chan struct{}
+	// watchState is one of watchNotStarted, watchRunning or watchStopped,
+	// accessed atomically.
+	watchState int32
+	// stop is closed by Close to end the watch.
+	stop      chan struct{}
+	closeOnce sync.Once
+
+	// pending is the status of the reload in progress, guarded by mu.
+	pending  Status
+	statusMu sync.RWMutex
+	status   Status
 }
 
 func (l *Loader) Snapshot() snapshot.IFace {
@@ -105,93 +217,170 @@ func (l *Loader) AddUpdateCallback(callback chan<- int) {
 }
 
 func (l *Loader) onRuntimeChanged() {
-	targetDir := filepath.Join(l.watchPath, l.subdirectory)
-
-	l.nextSnapshot = snapshot.New()
-	filepath.Walk(targetDir, l.walkDirectoryCallback)
-
-	l.stats.loadAttempts.Inc()
-	l.stats.numValues.Set(uint64(len(l.nextSnapshot.Entries())))
-	l.currentSnapshot.Store(l.nextSnapshot)
-
-	l.nextSnapshot = nil
-	l.callbacks.Signal()
-}
-
-type walkError struct {
-	err error
+	l.reload()
 }
 
-func (l *Loader) walkDirectoryCallback(path string, info os.FileInfo, err error) error {
-	if err != nil {
-		l.stats.loadFailures.Inc()
-		logger.Warnf("runtime: error processing %s: %s", path, err)
-
-		return nil
-	}
+// reload builds a new snapshot from the source and publishes it. If the source
+// cannot list its keys the current snapshot is kept and the error returned.
+func (l *Loader) reload() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 
-	if l.ignoreDotfiles && info.IsDir() && strings.HasPrefix(info.Name(), ".") {
-		return filepath.SkipDir
+	if l.source == nil {
+		l.source = &fileSource{loader: l}
 	}
+	l.pending = Status{}
+	l.stats.loadAttempts.Inc()
+	defer l.GenerateStats()
 
-	if !info.IsDir() {
-		if l.ignoreDotfiles && strings.HasPrefix(info.Name(), ".") {
-			return nil
+	walk := l.stats.walkTime.AllocateSpan()
+	keys, err := l.source.Keys()
+	walk.Complete()
+	if err != nil {
+		switch err := err.(type) {
+		case *LimitViolation:
+			l.stats.loadRejections.Inc()
+		case *gitRefError:
+			l.stats.loadFailures.Inc()
+			err.class.Inc()
+			l.log().Warn("runtime: error loading git ref", pathField(l.watchPath), refField(l.gitRef), errorField(err))
+		default:
+			l.stats.loadFailures.Inc()
+			l.stats.readError(err).Inc()
+			l.log().Warn("runtime: error listing keys", errorField(err))
 		}
+		l.rejectReload(err)
+		return err
+	}
 
-		contents, err := ioutil.ReadFile(path)
-
+	parse := l.stats.parseTime.AllocateSpan()
+	nextSnapshot := snapshot.New()
+	for _, key := range keys {
+		e, err := l.source.Get(key)
 		if err != nil {
 			l.stats.loadFailures.Inc()
-			logger.Warnf("runtime: error reading %s: %s", path, err)
-
-			return nil
+			l.stats.readError(err).Inc()
+			l.log().Warn("runtime: error getting key", keyField(key), errorField(err))
+			continue
+		}
+		if l.schema != nil {
+			if e = l.validateEntry(key, e); e == nil {
+				continue
+			}
+		}
+		nextSnapshot.SetEntry(key, e)
+	}
+	if l.schema != nil {
+		l.validateRequired(nextSnapshot)
+		if rejected := l.rejectedBySchema(); len(rejected) > 0 {
+			parse.Complete()
+			l.stats.loadRejections.Inc()
+			l.rejectReload(rejected)
+			return rejected
+		}
+	}
+	if source, ok := l.source.(MetadataSource); ok {
+		for key, value := range source.Metadata() {
+			nextSnapshot.SetMetadata(key, value)
 		}
+	}
+	parse.Complete()
+
+	publish := l.stats.publishTime.AllocateSpan()
+	l.stats.numValues.Set(uint64(len(nextSnapshot.Entries())))
+	previous := l.Snapshot()
+	l.publish(nextSnapshot)
+
+	l.pending.LoadedAt = time.Now()
+	l.pending.NumValues = len(nextSnapshot.Entries())
+	l.statusMu.Lock()
+	l.status = l.pending
+	l.statusMu.Unlock()
+	l.updateReady(nextSnapshot)
+
+	if dropped := l.callbacks.Signal(); dropped > 0 {
+		l.stats.callbacksDropped.Add(uint64(dropped))
+	}
+	publish.Complete()
+	l.notifySubscribers(nextSnapshot, previous)
+	return nil
+}
 
-		key, err := filepath.Rel(filepath.Join(l.watchPath, l.subdirectory), path)
+// GenerateStats sets the seconds_since_reload gauge to the time since the
+// current snapshot was published. It is set after every reload; to keep it
+// current in between, add the loader to the stats store, which calls this on
+// every flush:
+//
+//	store.AddStatGenerator(runtime.(*loader.Loader))
+func (l *Loader) GenerateStats() {
+	l.statusMu.RLock()
+	loadedAt := l.status.LoadedAt
+	l.statusMu.RUnlock()
+
+	if !loadedAt.IsZero() {
+		l.stats.secondsSinceReload.Set(uint64(time.Since(loadedAt) / time.Second))
+	}
+}
 
-		if err != nil {
-			l.stats.loadFailures.Inc()
-			logger.Warnf("runtime: error parsing path %s: %s", path, err)
+// publish makes s the current snapshot. The generation is only incremented
+// once s is visible, so a reader that sees the new generation sees s or later.
+func (l *Loader) publish(s snapshot.IFace) {
+	l.currentSnapshot.Store(s)
+	atomic.AddUint64(&l.generation, 1)
+}
 
-			return nil
-		}
+// Generation returns the number of snapshots published so far. It changes
+// whenever Snapshot does, and is cheaper to check, so it can be used to cache
+// values derived from the current snapshot.
+func (l *Loader) Generation() uint64 {
+	return atomic.LoadUint64(&l.generation)
+}
 
-		key = strings.Replace(key, "/", ".", -1)
-		stringValue := string(contents)
-		e := &entry.Entry{
-			StringValue: stringValue,
-			Uint64Value: 0,
-			Uint64Valid: false,
-			Modified:    info.ModTime(),
-		}
+// rejectReload records that the reload in progress failed with err and the
+// current snapshot was kept. If there is no snapshot yet an empty one is
+// published, so Snapshot never returns nil.
+func (l *Loader) rejectReload(err error) {
+	if l.Snapshot() == nil {
+		l.publish(snapshot.New())
+	}
 
-		uint64Value, err := strconv.ParseUint(strings.TrimSpace(stringValue), 10, 64)
-		if err == nil {
-			e.Uint64Value = uint64Value
-			e.Uint64Valid = true
-		}
+	l.statusMu.Lock()
+	defer l.statusMu.Unlock()
 
-		l.nextSnapshot.SetEntry(key, e)
-	}
+	l.pending.LoadedAt = l.status.LoadedAt
+	l.pending.NumValues = l.status.NumValues
+	l.pending.LastError = err
+	l.status = l.pending
+}
 
-	return nil
+// startWatching watches the source for changes in a new goroutine.
+func (l *Loader) startWatching() {
+	l.stop = make(chan struct{})
+	atomic.StoreInt32(&l.watchState, watchRunning)
+	go l.watch()
 }
 
-func getFileSystemOp(ev fsnotify.Event) FileSystemOp {
-	switch ev.Op {
-	case ev.Op & fsnotify.Write:
-		return Write
-	case ev.Op & fsnotify.Create:
-		return Create
-	case ev.Op & fsnotify.Chmod:
-		return Chmod
-	case ev.Op & fsnotify.Remove:
-		return Remove
-	case ev.Op & fsnotify.Rename:
-		return Rename
+func (l *Loader) watch() {
+	defer atomic.StoreInt32(&l.watchState, watchStopped)
+	if err := l.source.Watch(l.stop, l.onRuntimeChanged); err != nil {
+		l.log().Error("runtime: stopped watching for changes", errorField(err))
 	}
-	return -1
+}
+
+// Close stops watching for changes and releases the filesystem watcher. The
+// current snapshot stays available, but is never reloaded again, and Health
+// reports the loader as no longer watching. Close may be called more than once.
+func (l *Loader) Close() error {
+	var err error
+	l.closeOnce.Do(func() {
+		if l.stop != nil {
+			close(l.stop)
+		}
+		if s, ok := l.source.(*fileSource); ok && s.watcher != nil {
+			err = s.watcher.Close()
+		}
+	})
+	return err
 }
 
 type Option func(l *Loader)
@@ -200,11 +389,33 @@ func AllowDotFiles(l *Loader)  { l.ignoreDotfiles = false }
 func IgnoreDotFiles(l *Loader) { l.ignoreDotfiles = true }
 
 func New2(runtimePath, runtimeSubdirectory string, scope stats.Scope, refresher Refresher, opts ...Option) (IFace, error) {
+	return NewFromWatchRefresher(runtimePath, runtimeSubdirectory, scope, AdaptRefresher(refresher), opts...)
+}
+
+// NewFromWatchRefresher is like New2, but takes a WatchRefresher that manages
+// its own set of watched paths.
+func NewFromWatchRefresher(runtimePath, runtimeSubdirectory string, scope stats.Scope, refresher WatchRefresher, opts ...Option) (IFace, error) {
+	newLoader := Loader{
+		watchPath:    runtimePath,
+		subdirectory: runtimeSubdirectory,
+		stats:        newLoaderStats(scope),
+	}
+
+	for _, opt := range opts {
+		opt(&newLoader)
+	}
+
 	if runtimePath == "" || runtimeSubdirectory == "" {
-		logger.Warn("no runtime configuration. using nil loader.")
+		newLoader.log().Warn("no runtime configuration. using nil loader.")
 		return NewNil(), nil
 	}
-	watchedPath := refresher.WatchDirectory(runtimePath, runtimeSubdirectory)
+
+	if newLoader.waitCtx != nil {
+		// The directory must exist before the refresher can watch it.
+		if err := newLoader.waitForPath(newLoader.waitCtx); err != nil {
+			return nil, err
+		}
+	}
 
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
@@ -216,40 +427,87 @@ func New2(runtimePath, runtimeSubdirectory string, scope stats.Scope, refresher
 		return nil, fmt.Errorf("unable to create runtime watcher: %[1]s (%[1]T %#[1]v)\n", err)
 	}
 
-	err = watcher.Add(watchedPath)
-	if err != nil {
-		return nil, fmt.Errorf("unable to watch file (%[1]s): %[2]s (%[2]T %#[2]v)", watchedPath, err)
+	paths := newPathWatcher(watcher)
+	newLoader.setLogger(refresher)
+	if err := refresher.Watch(runtimePath, runtimeSubdirectory, paths); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	newLoader.source = &fileSource{
+		loader:    &newLoader,
+		watcher:   paths,
+		refresher: refresher,
 	}
 
+	if newLoader.waitCtx != nil {
+		if err := newLoader.waitForInitialLoad(newLoader.waitCtx); err != nil {
+			watcher.Close()
+			return nil, err
+		}
+	} else {
+		newLoader.onRuntimeChanged()
+	}
+	newLoader.startWatching()
+
+	return &newLoader, nil
+}
+
+// NewFromSource creates a loader that builds snapshots from source and reloads
+// them whenever source reports a change. An error is returned if the initial
+// snapshot cannot be built, or with WaitForInitialLoad, if it is not ready in
+// time. Options that only apply to the filesystem, such as IgnoreDotFiles, have
+// no effect.
+func NewFromSource(source Source, scope stats.Scope, opts ...Option) (IFace, error) {
 	newLoader := Loader{
-		watcher:      watcher,
-		watchPath:    runtimePath,
-		subdirectory: runtimeSubdirectory,
-		stats:        newLoaderStats(scope),
+		source: source,
+		stats:  newLoaderStats(scope),
 	}
 
 	for _, opt := range opts {
 		opt(&newLoader)
 	}
-
-	newLoader.onRuntimeChanged()
-
-	go func() {
-		for {
-			select {
-			case ev := <-watcher.Events:
-				if refresher.ShouldRefresh(ev.Name, getFileSystemOp(ev)) {
-					newLoader.onRuntimeChanged()
-				}
-			case err := <-watcher.Errors:
-				logger.Warnf("runtime watch error: %s", err)
-			}
+	newLoader.setLogger(source)
+
+	if newLoader.waitCtx != nil {
+		// Sources that are pushed their data, such as RTDS, only receive it
+		// while watched, so the watch runs while waiting.
+		newLoader.startWatching()
+		if err := newLoader.waitForInitialLoad(newLoader.waitCtx); err != nil {
+			newLoader.Close()
+			return nil, err
 		}
-	}()
+		return &newLoader, nil
+	}
+
+	if err := newLoader.reload(); err != nil {
+		return nil, fmt.Errorf("unable to load runtime: %s", err)
+	}
+	newLoader.startWatching()
 
 	return &newLoader, nil
 }
 
+// Load builds a single snapshot of the runtime at runtimePath and
+// runtimeSubdirectory, exactly as New2 with the same options would, without
+// watching for changes. It is meant for tools that check a runtime tree. The
+// returned Loader, whose Status describes the load, is also returned along
+// with the error if the load was rejected.
+func Load(runtimePath string, runtimeSubdirectory string, scope stats.Scope, opts ...Option) (*Loader, error) {
+	newLoader := &Loader{
+		watchPath:    runtimePath,
+		subdirectory: runtimeSubdirectory,
+		stats:        newLoaderStats(scope),
+	}
+	newLoader.source = &fileSource{loader: newLoader}
+
+	for _, opt := range opts {
+		opt(newLoader)
+	}
+
+	return newLoader, newLoader.reload()
+}
+
 // Deprecated: use New2 instead
 func New(runtimePath string, runtimeSubdirectory string, scope stats.Scope, refresher Refresher, opts ...Option) IFace {
 	loader, err := New2(runtimePath, runtimeSubdirectory, scope, refresher, opts...)
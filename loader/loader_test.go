@@ -12,7 +12,9 @@ import (
 
 	"time"
 
+	"github.com/lyft/goruntime/snapshot/entry"
 	stats "github.com/lyft/gostats"
+	"github.com/lyft/gostats/mock"
 	logger "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
 )
@@ -332,6 +334,237 @@ func TestOnRuntimeChanged(t *testing.T) {
 			t.Fatalf("Time out after: %s", Timeout)
 		}
 	})
+
+	t.Run("Generation", func(t *testing.T) {
+		before := ll.Generation()
+		ll.onRuntimeChanged()
+		if g := ll.Generation(); g != before+1 {
+			t.Errorf("Generation: got: %d want: %d", g, before+1)
+		}
+	})
+}
+
+func TestSymlinkChainRefresher(t *testing.T) {
+	assert := require.New(t)
+
+	// Setup base test directory.
+	tempDir, err := ioutil.TempDir("", "chain_runtime_test")
+	assert.NoError(err)
+	defer os.RemoveAll(tempDir)
+
+	// Mimic a Kubernetes volume: ..data is a relative link to a timestamped
+	// directory, and the runtime path is a relative link to ..data in another
+	// directory.
+	makeFileInDir(assert, tempDir+"/volume/..2020_01_01/app/file1", "hello")
+	assert.NoError(os.Symlink("..2020_01_01", tempDir+"/volume/..data"))
+	assert.NoError(os.MkdirAll(tempDir+"/srv", os.ModePerm))
+	assert.NoError(os.Symlink("../volume/..data", tempDir+"/srv/current"))
+
+	refresher := &SymlinkChainRefresher{RuntimePath: tempDir + "/srv/current"}
+	loader := New(tempDir+"/srv/current", "app", nullScope, refresher, AllowDotFiles)
+	defer loader.(*Loader).Close()
+	runtime_update := make(chan int)
+	loader.AddUpdateCallback(runtime_update)
+	assert.Equal("hello", loader.Snapshot().Get("file1"))
+
+	watcher := loader.(*Loader).source.(*fileSource).watcher
+	assert.Equal([]string{tempDir + "/srv", tempDir + "/volume"}, watcher.Paths())
+	// Paths the loader watches itself, such as git refs, are not the
+	// refresher's to remove.
+	assert.NoError(watcher.Add(tempDir))
+
+	// Atomically swap ..data to a new timestamped directory.
+	makeFileInDir(assert, tempDir+"/volume/..2020_01_02/app/file1", "hello2")
+	assert.NoError(os.Symlink("..2020_01_02", tempDir+"/volume/..data_tmp"))
+	assert.NoError(os.Rename(tempDir+"/volume/..data_tmp", tempDir+"/volume/..data"))
+
+	<-runtime_update
+	assert.Equal("hello2", loader.Snapshot().Get("file1"))
+	assert.Equal([]string{tempDir, tempDir + "/srv", tempDir + "/volume"}, watcher.Paths())
+
+	// Unrelated changes in the watched directories do not refresh.
+	assert.False(refresher.ShouldRefresh(tempDir+"/volume/other", Create))
+}
+
+func TestResolveSymlinkChain(t *testing.T) {
+	assert := require.New(t)
+
+	tempDir, err := ioutil.TempDir("", "chain_runtime_test")
+	assert.NoError(err)
+	defer os.RemoveAll(tempDir)
+	tempDir, err = filepath.EvalSymlinks(tempDir)
+	assert.NoError(err)
+
+	assert.NoError(os.MkdirAll(tempDir+"/a/target", os.ModePerm))
+	assert.NoError(os.MkdirAll(tempDir+"/b", os.ModePerm))
+	assert.NoError(os.Symlink("target", tempDir+"/a/link1"))
+	assert.NoError(os.Symlink(tempDir+"/a/link1", tempDir+"/b/link2"))
+	assert.NoError(os.Symlink("../b/link2", tempDir+"/a/link3"))
+
+	target, links, err := resolveSymlinkChain(tempDir + "/a/link3")
+	assert.NoError(err)
+	assert.Equal(tempDir+"/a/target", target)
+	assert.Equal([]string{tempDir + "/a/link3", tempDir + "/b/link2", tempDir + "/a/link1"}, links)
+
+	assert.NoError(os.Symlink("loop2", tempDir+"/a/loop1"))
+	assert.NoError(os.Symlink("loop1", tempDir+"/a/loop2"))
+	_, _, err = resolveSymlinkChain(tempDir + "/a/loop1")
+	assert.Error(err)
+
+	_, _, err = resolveSymlinkChain(tempDir + "/a/missing")
+	assert.Error(err)
+}
+
+// countingRefresher counts how often the wrapped refresher asks for a refresh.
+type countingRefresher struct {
+	Refresher
+	refreshes int32
+}
+
+func (c *countingRefresher) ShouldRefresh(path string, op FileSystemOp) bool {
+	if c.Refresher.ShouldRefresh(path, op) {
+		atomic.AddInt32(&c.refreshes, 1)
+		return true
+	}
+	return false
+}
+
+// writeConfigMap publishes files the way the Kubernetes atomic writer does.
+func writeConfigMap(assert *require.Assertions, dir string, version string, files map[string]string) {
+	for name, contents := range files {
+		makeFileInDir(assert, filepath.Join(dir, version, name), contents)
+	}
+	previous, _ := os.Readlink(filepath.Join(dir, "..data"))
+
+	assert.NoError(os.Symlink(version, filepath.Join(dir, "..data_tmp")))
+	assert.NoError(os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")))
+
+	for name := range files {
+		link := filepath.Join(dir, name)
+		if _, err := os.Lstat(link); os.IsNotExist(err) {
+			assert.NoError(os.Symlink(filepath.Join("..data", name), link))
+		}
+	}
+	if previous != "" {
+		assert.NoError(os.RemoveAll(filepath.Join(dir, previous)))
+	}
+}
+
+func TestConfigMapRefresher(t *testing.T) {
+	assert := require.New(t)
+
+	tempDir, err := ioutil.TempDir("", "configmap_runtime_test")
+	assert.NoError(err)
+	defer os.RemoveAll(tempDir)
+
+	appDir := tempDir + "/app"
+	writeConfigMap(assert, appDir, "..2020_01_01", map[string]string{"file1": "hello", ".file2": "20"})
+
+	refresher := &countingRefresher{Refresher: &ConfigMapRefresher{}}
+	loader := New(tempDir, "app", nullScope, refresher, AllowDotFiles, KubernetesConfigMap)
+	defer loader.(*Loader).Close()
+	runtime_update := make(chan int)
+	loader.AddUpdateCallback(runtime_update)
+
+	snapshot := loader.Snapshot()
+	keys := snapshot.Keys()
+	sort.Strings(keys)
+	assert.Equal([]string{".file2", "file1"}, keys)
+	assert.Equal("hello", snapshot.Get("file1"))
+
+	writeConfigMap(assert, appDir, "..2020_01_02", map[string]string{"file1": "hello2", ".file2": "30"})
+	<-runtime_update
+	time.Sleep(100 * time.Millisecond)
+
+	snapshot = loader.Snapshot()
+	keys = snapshot.Keys()
+	sort.Strings(keys)
+	assert.Equal([]string{".file2", "file1"}, keys)
+	assert.Equal("hello2", snapshot.Get("file1"))
+	assert.Equal(uint64(30), snapshot.GetInteger(".file2", 0))
+	assert.Equal(int32(1), atomic.LoadInt32(&refresher.refreshes))
+}
+
+func TestConfigMapMissingData(t *testing.T) {
+	assert := require.New(t)
+
+	tempDir, err := ioutil.TempDir("", "configmap_runtime_test")
+	assert.NoError(err)
+	defer os.RemoveAll(tempDir)
+
+	makeFileInDir(assert, tempDir+"/app/..2020_01_01/file1", "hello")
+	loader := New(tempDir, "app", nullScope, &ConfigMapRefresher{}, AllowDotFiles, KubernetesConfigMap)
+	defer loader.(*Loader).Close()
+	assert.Empty(loader.Snapshot().Keys())
+}
+
+// multiRootRefresher watches several directories and refreshes on any write,
+// or only on writes in trigger if it is set.
+type multiRootRefresher struct {
+	roots   []string
+	trigger string
+}
+
+func (m *multiRootRefresher) Watch(runtimePath string, appDirPath string, watcher PathWatcher) error {
+	for _, root := range m.roots {
+		if err := watcher.Add(root); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *multiRootRefresher) ShouldRefresh(path string, op FileSystemOp) bool {
+	if m.trigger != "" && filepath.Dir(path) != m.trigger {
+		return false
+	}
+	return op == Create || op == Write
+}
+
+func (m *multiRootRefresher) WatchError(err error) {}
+
+func TestWatchRefresher(t *testing.T) {
+	assert := require.New(t)
+
+	tempDir, err := ioutil.TempDir("", "watch_refresher_test")
+	assert.NoError(err)
+	defer os.RemoveAll(tempDir)
+
+	appDir := tempDir + "/app"
+	otherDir := tempDir + "/other"
+	assert.NoError(os.MkdirAll(appDir, os.ModePerm))
+	assert.NoError(os.MkdirAll(otherDir, os.ModePerm))
+
+	refresher := &multiRootRefresher{roots: []string{appDir, otherDir}, trigger: otherDir}
+	loader, err := NewFromWatchRefresher(tempDir, "app", nullScope, refresher, AllowDotFiles)
+	assert.NoError(err)
+	defer loader.(*Loader).Close()
+	runtime_update := make(chan int)
+	loader.AddUpdateCallback(runtime_update)
+	assert.Equal([]string{appDir, otherDir}, loader.(*Loader).source.(*fileSource).watcher.Paths())
+
+	// A change in the second root triggers a reload of the runtime directory.
+	// Changes in the runtime directory itself do not, so file1 can only be
+	// loaded by the reload the trigger causes.
+	assert.NoError(ioutil.WriteFile(appDir+"/file1", []byte("hello"), os.ModePerm))
+	assert.Equal("", loader.Snapshot().Get("file1"))
+	makeFileInDir(assert, otherDir+"/trigger", "")
+	<-runtime_update
+	assert.Equal("hello", loader.Snapshot().Get("file1"))
+
+	_, err = NewFromWatchRefresher(tempDir, "app", nullScope, &multiRootRefresher{roots: []string{tempDir + "/missing"}})
+	assert.Error(err)
+}
+
+func TestAdaptRefresher(t *testing.T) {
+	assert := require.New(t)
+
+	chain := &SymlinkChainRefresher{}
+	assert.Equal(chain, AdaptRefresher(chain))
+
+	adapted := AdaptRefresher(&DirectoryRefresher{})
+	_, ok := adapted.(refresherAdapter)
+	assert.True(ok)
 }
 
 func TestShouldRefreshDefault(t *testing.T) {
@@ -390,3 +623,153 @@ func BenchmarkSnapshot_Parallel(b *testing.B) {
 		}
 	})
 }
+
+func TestLoad(t *testing.T) {
+	assert := require.New(t)
+
+	tempDir, err := ioutil.TempDir("", "load_test")
+	assert.NoError(err)
+	defer os.RemoveAll(tempDir)
+
+	makeFileInDir(assert, tempDir+"/app/file1", "hello")
+	makeFileInDir(assert, tempDir+"/app/file2", "world")
+	assert.NoError(os.Symlink(tempDir+"/missing", tempDir+"/app/dangling"))
+
+	l, err := Load(tempDir, "app", nullScope)
+	assert.NoError(err)
+	assert.Equal("hello", l.Snapshot().Get("file1"))
+	status := l.Status()
+	assert.Equal(2, status.NumValues)
+	assert.Len(status.FileErrors, 1)
+	assert.Equal(tempDir+"/app/dangling", status.FileErrors[0].Path)
+	assert.Equal([]string{status.FileErrors[0].Error()}, status.Problems())
+
+	l, err = Load(tempDir, "app", nullScope, MaxKeys(1), OnLimitExceeded(RejectOverLimit))
+	assert.Error(err)
+	assert.Equal(err, l.Status().LastError)
+}
+
+func TestLoaderStats(t *testing.T) {
+	assert := require.New(t)
+
+	tempDir, err := ioutil.TempDir("", "stats_test")
+	assert.NoError(err)
+	defer os.RemoveAll(tempDir)
+
+	makeFileInDir(assert, tempDir+"/app/file1", "hello")
+	assert.NoError(os.Symlink(tempDir+"/missing", tempDir+"/app/dangling"))
+	// Root can read anything, so permission errors can only be tested as another user.
+	checkPermissions := os.Geteuid() != 0
+	if checkPermissions {
+		makeFileInDir(assert, tempDir+"/app/secret", "hidden")
+		assert.NoError(os.Chmod(tempDir+"/app/secret", 0))
+	}
+
+	sink := mock.NewSink()
+	store := stats.NewStore(sink, false)
+	l, err := Load(tempDir, "app", store.Scope("runtime"))
+	assert.NoError(err)
+	store.Flush()
+
+	sink.AssertCounterEquals(t, "runtime.load_attempts", 1)
+	sink.AssertCounterEquals(t, "runtime.read_errors", 1)
+	if checkPermissions {
+		sink.AssertCounterEquals(t, "runtime.permission_errors", 1)
+		sink.AssertCounterEquals(t, "runtime.load_failures", 2)
+	} else {
+		sink.AssertCounterEquals(t, "runtime.load_failures", 1)
+	}
+	sink.AssertTimerExists(t, "runtime.walk_time")
+	sink.AssertTimerExists(t, "runtime.parse_time")
+	sink.AssertTimerExists(t, "runtime.publish_time")
+	sink.AssertGaugeEquals(t, "runtime.seconds_since_reload", 0)
+
+	l.statusMu.Lock()
+	l.status.LoadedAt = time.Now().Add(-90 * time.Second)
+	l.statusMu.Unlock()
+	store.AddStatGenerator(l)
+	store.Flush()
+	sink.AssertGaugeEquals(t, "runtime.seconds_since_reload", 90)
+
+	// A dangling symlink cannot be resolved when confined.
+	sink = mock.NewSink()
+	store = stats.NewStore(sink, false)
+	_, err = Load(tempDir, "app", store.Scope("runtime"), ConfineToRuntimeRoot)
+	assert.NoError(err)
+	store.Flush()
+	sink.AssertCounterEquals(t, "runtime.path_errors", 1)
+	sink.AssertCounterNotExists(t, "runtime.read_errors")
+
+	// Keys are listed again on every attempt, even when the listing fails.
+	sink = mock.NewSink()
+	store = stats.NewStore(sink, false)
+	_, err = NewFromSource(failingSource{}, store.Scope("runtime"))
+	assert.Error(err)
+	store.Flush()
+	sink.AssertCounterEquals(t, "runtime.load_attempts", 1)
+	sink.AssertCounterEquals(t, "runtime.load_failures", 1)
+	sink.AssertCounterEquals(t, "runtime.permission_errors", 1)
+}
+
+type failingSource struct{}
+
+func (failingSource) Keys() ([]string, error) { return nil, os.ErrPermission }
+func (failingSource) Get(key string) (*entry.Entry, error) {
+	return nil, os.ErrNotExist
+}
+func (failingSource) Watch(stop <-chan struct{}, changed func()) error { return nil }
+
+func TestCallbacksDropped(t *testing.T) {
+	assert := require.New(t)
+
+	var c callbacks
+	notify := make(chan struct{}, 1)
+	c.cbs = append(c.cbs, notify)
+	assert.Equal(0, c.Signal())
+	assert.Equal(1, c.Signal())
+	<-notify
+	assert.Equal(0, c.Signal())
+
+	tempDir, err := ioutil.TempDir("", "stats_test")
+	assert.NoError(err)
+	defer os.RemoveAll(tempDir)
+	makeFileInDir(assert, tempDir+"/app/file1", "hello")
+
+	sink := mock.NewSink()
+	store := stats.NewStore(sink, false)
+	loader, err := New2(tempDir, "app", store.Scope("runtime"), &manualRefresher{})
+	assert.NoError(err)
+	defer loader.(*Loader).Close()
+	l := loader.(*Loader)
+	// Nothing reads from the callback, so once it is blocked on one signal and
+	// holding another, later signals are dropped.
+	l.AddUpdateCallback(make(chan int))
+	for i := 0; i < 3; i++ {
+		assert.NoError(l.reload())
+	}
+	store.Flush()
+	dropped := sink.Counter("runtime.callbacks_dropped")
+	assert.True(dropped >= 1 && dropped <= 2, "dropped %d", dropped)
+}
+
+func TestClose(t *testing.T) {
+	assert := require.New(t)
+
+	tempDir, err := ioutil.TempDir("", "dir_runtime_test")
+	assert.NoError(err)
+	defer os.RemoveAll(tempDir)
+
+	makeFileInDir(assert, tempDir+"/app/file1", "hello")
+	loader, err := New2(tempDir, "app", nullScope, &DirectoryRefresher{})
+	assert.NoError(err)
+	l := loader.(*Loader)
+
+	assert.NoError(l.Close())
+	assert.NoError(l.Close())
+	assert.Eventually(func() bool { return !l.Health().Watching }, time.Second, time.Millisecond)
+
+	// Changes are no longer loaded, but the last snapshot stays available.
+	makeFileInDir(assert, tempDir+"/app/file1", "world")
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal("hello", l.Snapshot().Get("file1"))
+}
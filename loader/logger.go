@@ -0,0 +1,103 @@
+package loader
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+// Field is a named value attached to a log message, such as the path or key
+// the message is about.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Names of the fields attached to log messages.
+const (
+	FieldPath   = "path"
+	FieldKey    = "key"
+	FieldOp     = "op"
+	FieldError  = "error"
+	FieldTarget = "target"
+	FieldRef    = "ref"
+)
+
+func pathField(path string) Field   { return Field{Key: FieldPath, Value: path} }
+func keyField(key string) Field     { return Field{Key: FieldKey, Value: key} }
+func errorField(err error) Field    { return Field{Key: FieldError, Value: err} }
+func refField(ref string) Field     { return Field{Key: FieldRef, Value: ref} }
+func targetField(t string) Field    { return Field{Key: FieldTarget, Value: t} }
+func opField(op FileSystemOp) Field { return Field{Key: FieldOp, Value: op.String()} }
+
+// A Logger receives the messages logged by a Loader. Implementations must be
+// safe for concurrent use.
+type Logger interface {
+	Debug(msg string, fields ...Field)
+	Info(msg string, fields ...Field)
+	Warn(msg string, fields ...Field)
+	Error(msg string, fields ...Field)
+}
+
+// WithLogger sends the loader's log messages to logger instead of the standard
+// logrus logger.
+func WithLogger(logger Logger) Option {
+	return func(l *Loader) { l.logger = logger }
+}
+
+// A LoggerSetter is a Source or WatchRefresher that logs. A loader created
+// with it passes it the loader's Logger before using it, so that everything
+// the loader does is logged in one place.
+type LoggerSetter interface {
+	SetLogger(logger Logger)
+}
+
+// setLogger passes the loader's Logger to v if v logs.
+func (l *Loader) setLogger(v interface{}) {
+	if s, ok := v.(LoggerSetter); ok {
+		s.SetLogger(l.log())
+	}
+}
+
+// NewLogrusLogger adapts a logrus logger or entry, adding fields as logrus fields.
+func NewLogrusLogger(logger logrus.FieldLogger) Logger {
+	return logrusLogger{logger}
+}
+
+type logrusLogger struct {
+	logger logrus.FieldLogger
+}
+
+func (l logrusLogger) with(fields []Field) logrus.FieldLogger {
+	if len(fields) == 0 {
+		return l.logger
+	}
+	f := make(logrus.Fields, len(fields))
+	for _, field := range fields {
+		f[field.Key] = field.Value
+	}
+	return l.logger.WithFields(f)
+}
+
+func (l logrusLogger) Debug(msg string, fields ...Field) { l.with(fields).Debug(msg) }
+func (l logrusLogger) Info(msg string, fields ...Field)  { l.with(fields).Info(msg) }
+func (l logrusLogger) Warn(msg string, fields ...Field)  { l.with(fields).Warn(msg) }
+func (l logrusLogger) Error(msg string, fields ...Field) { l.with(fields).Error(msg) }
+
+// NopLogger discards every message.
+var NopLogger Logger = nopLogger{}
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(msg string, fields ...Field) {}
+func (nopLogger) Info(msg string, fields ...Field)  {}
+func (nopLogger) Warn(msg string, fields ...Field)  {}
+func (nopLogger) Error(msg string, fields ...Field) {}
+
+// defaultLogger is used by loaders created without WithLogger.
+var defaultLogger = NewLogrusLogger(logrus.StandardLogger())
+
+func (l *Loader) log() Logger {
+	if l.logger == nil {
+		return defaultLogger
+	}
+	return l.logger
+}
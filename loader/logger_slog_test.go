@@ -0,0 +1,32 @@
+//go:build go1.21
+// +build go1.21
+
+package loader
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlogLogger(t *testing.T) {
+	assert := require.New(t)
+
+	var buf bytes.Buffer
+	l := NewSlogLogger(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo})))
+
+	l.Debug("not logged", pathField("/runtime/a"))
+	assert.Zero(buf.Len())
+
+	l.Warn("runtime: error reading file", pathField("/runtime/a"), errorField(errors.New("boom")))
+	var record map[string]interface{}
+	assert.NoError(json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal("WARN", record["level"])
+	assert.Equal("runtime: error reading file", record["msg"])
+	assert.Equal("/runtime/a", record[FieldPath])
+	assert.Equal("boom", record[FieldError])
+}
@@ -0,0 +1,89 @@
+package loader
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
+)
+
+type loggedMessage struct {
+	level  string
+	msg    string
+	fields map[string]interface{}
+}
+
+// recordingLogger keeps every message logged to it.
+type recordingLogger struct {
+	mu       sync.Mutex
+	messages []loggedMessage
+}
+
+func (r *recordingLogger) record(level string, msg string, fields []Field) {
+	m := loggedMessage{level: level, msg: msg, fields: map[string]interface{}{}}
+	for _, f := range fields {
+		m.fields[f.Key] = f.Value
+	}
+	r.mu.Lock()
+	r.messages = append(r.messages, m)
+	r.mu.Unlock()
+}
+
+func (r *recordingLogger) Debug(msg string, fields ...Field) { r.record("debug", msg, fields) }
+func (r *recordingLogger) Info(msg string, fields ...Field)  { r.record("info", msg, fields) }
+func (r *recordingLogger) Warn(msg string, fields ...Field)  { r.record("warn", msg, fields) }
+func (r *recordingLogger) Error(msg string, fields ...Field) { r.record("error", msg, fields) }
+
+func TestWithLogger(t *testing.T) {
+	assert := require.New(t)
+
+	tempDir, err := ioutil.TempDir("", "logger_test")
+	assert.NoError(err)
+	defer os.RemoveAll(tempDir)
+
+	makeFileInDir(assert, tempDir+"/app/file1", "hello")
+	assert.NoError(os.Symlink(tempDir+"/missing", tempDir+"/app/dangling"))
+
+	logs := &recordingLogger{}
+	_, err = Load(tempDir, "app", nullScope, WithLogger(logs))
+	assert.NoError(err)
+
+	assert.Len(logs.messages, 1)
+	m := logs.messages[0]
+	assert.Equal("warn", m.level)
+	assert.Equal("runtime: error reading file", m.msg)
+	assert.Equal(tempDir+"/app/dangling", m.fields[FieldPath])
+	assert.Error(m.fields[FieldError].(error))
+
+	logs = &recordingLogger{}
+	_, err = New2("", "", nullScope, &DirectoryRefresher{}, WithLogger(logs))
+	assert.NoError(err)
+	assert.Len(logs.messages, 1)
+	assert.Equal("no runtime configuration. using nil loader.", logs.messages[0].msg)
+}
+
+func TestLogrusLogger(t *testing.T) {
+	assert := require.New(t)
+
+	logger, hook := test.NewNullLogger()
+	logger.SetLevel(logrus.DebugLevel)
+	l := NewLogrusLogger(logger)
+
+	l.Warn("runtime: error reading file", pathField("/runtime/a"), opField(Write))
+	entry := hook.LastEntry()
+	assert.Equal(logrus.WarnLevel, entry.Level)
+	assert.Equal("runtime: error reading file", entry.Message)
+	assert.Equal(logrus.Fields{FieldPath: "/runtime/a", FieldOp: "write"}, entry.Data)
+
+	l.Debug("debug")
+	assert.Equal(logrus.DebugLevel, hook.LastEntry().Level)
+	l.Info("info")
+	assert.Equal(logrus.InfoLevel, hook.LastEntry().Level)
+	l.Error("error", keyField("a"))
+	assert.Equal(logrus.ErrorLevel, hook.LastEntry().Level)
+	assert.Equal(logrus.Fields{FieldKey: "a"}, hook.LastEntry().Data)
+}
@@ -0,0 +1,43 @@
+// Package middleware pins the current runtime snapshot to the context of each
+// incoming HTTP or gRPC request, so a handler reads every runtime key from the
+// same snapshot. Handlers retrieve it with loader.SnapshotFromContext.
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/lyft/goruntime/loader"
+	"google.golang.org/grpc"
+)
+
+// HTTP returns a handler that pins the current snapshot of l to the request
+// context before calling next.
+func HTTP(l loader.IFace, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(loader.Pin(r.Context(), l)))
+	})
+}
+
+// UnaryServerInterceptor pins the current snapshot of l to the context of
+// each unary call.
+func UnaryServerInterceptor(l loader.IFace) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return handler(loader.Pin(ctx, l), req)
+	}
+}
+
+// StreamServerInterceptor pins the current snapshot of l to the context of
+// each stream, for its whole lifetime.
+func StreamServerInterceptor(l loader.IFace) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &pinnedStream{ServerStream: ss, ctx: loader.Pin(ss.Context(), l)})
+	}
+}
+
+type pinnedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *pinnedStream) Context() context.Context { return s.ctx }
@@ -0,0 +1,106 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lyft/goruntime/loader"
+	"github.com/lyft/goruntime/loader/middleware"
+	"github.com/lyft/goruntime/snapshot"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+// switchingLoader publishes a new snapshot every time Snapshot is called, as
+// if a reload happened between every read.
+type switchingLoader struct {
+	version int
+}
+
+func (l *switchingLoader) Snapshot() snapshot.IFace {
+	l.version++
+	return snapshot.NewMock().SetUInt64("version", uint64(l.version))
+}
+
+func (*switchingLoader) AddUpdateCallback(callback chan<- int) {}
+
+// readTwice reads the version twice from the snapshot pinned in ctx.
+func readTwice(ctx context.Context, l loader.IFace) [2]uint64 {
+	return [2]uint64{
+		loader.SnapshotFromContext(ctx, l).GetInteger("version", 0),
+		loader.SnapshotFromContext(ctx, l).GetInteger("version", 0),
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	assert := require.New(t)
+
+	l := &switchingLoader{}
+	var versions [2]uint64
+	handler := middleware.HTTP(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		versions = readTwice(r.Context(), l)
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	assert.Equal([2]uint64{1, 1}, versions)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	assert.Equal([2]uint64{2, 2}, versions)
+}
+
+func TestHTTPTwoLoaders(t *testing.T) {
+	assert := require.New(t)
+
+	// Each loader's middleware pins its own snapshot, whichever runs first.
+	l1, l2 := &switchingLoader{}, &switchingLoader{version: 100}
+	var versions1, versions2 [2]uint64
+	handler := middleware.HTTP(l1, middleware.HTTP(l2, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		versions1 = readTwice(r.Context(), l1)
+		versions2 = readTwice(r.Context(), l2)
+	})))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	assert.Equal([2]uint64{1, 1}, versions1)
+	assert.Equal([2]uint64{101, 101}, versions2)
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	assert := require.New(t)
+
+	l := &switchingLoader{}
+	interceptor := middleware.UnaryServerInterceptor(l)
+	resp, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return readTwice(ctx, l), nil
+	})
+	assert.NoError(err)
+	assert.Equal([2]uint64{1, 1}, resp)
+
+	// A context that already carries a snapshot of l keeps it.
+	ctx := snapshot.NewContext(context.Background(), l, snapshot.NewMock().SetUInt64("version", 42))
+	resp, err = interceptor(ctx, nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return readTwice(ctx, l), nil
+	})
+	assert.NoError(err)
+	assert.Equal([2]uint64{42, 42}, resp)
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s serverStream) Context() context.Context { return s.ctx }
+
+func TestStreamServerInterceptor(t *testing.T) {
+	assert := require.New(t)
+
+	l := &switchingLoader{}
+	var versions [2]uint64
+	err := middleware.StreamServerInterceptor(l)(nil, serverStream{ctx: context.Background()}, &grpc.StreamServerInfo{}, func(srv interface{}, stream grpc.ServerStream) error {
+		versions = readTwice(stream.Context(), l)
+		return nil
+	})
+	assert.NoError(err)
+	assert.Equal([2]uint64{1, 1}, versions)
+}
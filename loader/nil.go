@@ -14,3 +14,6 @@ func NewNil() Nil {
 func (n Nil) Snapshot() snapshot.IFace { return n.snapshot }
 
 func (Nil) AddUpdateCallback(callback chan<- int) {}
+
+// Generation is always zero, since the snapshot of a Nil loader never changes.
+func (Nil) Generation() uint64 { return 0 }
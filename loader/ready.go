@@ -0,0 +1,140 @@
+package loader
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lyft/goruntime/snapshot"
+)
+
+// Bounds of the delay between reloads while waiting for the initial load.
+const (
+	minReadyPoll = 50 * time.Millisecond
+	maxReadyPoll = time.Second
+)
+
+// WaitForInitialLoad makes New2, NewFromWatchRefresher and NewFromSource block
+// until the loader is ready, as defined by WaitReady, reloading with backoff
+// while it waits. For the filesystem the runtime directory may not exist yet,
+// for example while a sidecar is still syncing it. Sources are watched while
+// waiting, so those pushed their data, such as RTDS, are ready once it arrives.
+// If ctx is done first, the constructor returns an error and no loader.
+func WaitForInitialLoad(ctx context.Context) Option {
+	return func(l *Loader) { l.waitCtx = ctx }
+}
+
+// isReady reports whether s is ready to serve: it holds at least one key and,
+// if the loader has a schema, none of its required keys are missing.
+func (l *Loader) isReady(s snapshot.IFace) bool {
+	if len(s.Entries()) == 0 {
+		return false
+	}
+	return l.schema == nil || len(l.schema.Missing(s)) == 0
+}
+
+func (l *Loader) readyChan() chan struct{} {
+	l.readyMu.Lock()
+	defer l.readyMu.Unlock()
+	if l.ready == nil {
+		l.ready = make(chan struct{})
+	}
+	return l.ready
+}
+
+// updateReady marks the loader ready the first time it publishes a ready snapshot.
+func (l *Loader) updateReady(s snapshot.IFace) {
+	if !l.isReady(s) {
+		return
+	}
+	ready := l.readyChan()
+	select {
+	case <-ready:
+	default:
+		close(ready)
+	}
+}
+
+// WaitReady blocks until the loader has published a non-empty snapshot
+// holding every key its schema requires, or until ctx is done. Once ready, a
+// loader stays ready even if later snapshots are not, so WaitReady is meant
+// for startup; use Health to monitor a running loader.
+func (l *Loader) WaitReady(ctx context.Context) error {
+	select {
+	case <-l.readyChan():
+		return nil
+	case <-ctx.Done():
+		return l.notReady(ctx.Err())
+	}
+}
+
+// notReady describes why the loader is not ready after waiting failed with err.
+func (l *Loader) notReady(err error) error {
+	if lastError := l.Status().LastError; lastError != nil {
+		return fmt.Errorf("runtime is not ready: %w (last error: %s)", err, lastError)
+	}
+	if s := l.Snapshot(); s != nil && len(s.Entries()) > 0 && l.schema != nil {
+		var missing []string
+		for _, e := range l.schema.Missing(s) {
+			missing = append(missing, e.Key)
+		}
+		return fmt.Errorf("runtime is not ready: %w (missing required keys: %s)", err, strings.Join(missing, ", "))
+	}
+	return fmt.Errorf("runtime is not ready: %w", err)
+}
+
+// waitForPath blocks until the runtime directory exists.
+func (l *Loader) waitForPath(ctx context.Context) error {
+	path := filepath.Join(l.watchPath, l.subdirectory)
+	return poll(ctx, nil, func() bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}, func(err error) error {
+		return fmt.Errorf("runtime is not ready: waiting for %s: %w", path, err)
+	})
+}
+
+// waitForInitialLoad reloads, with backoff, until the loader is ready. A
+// reload triggered by the watch in the meantime ends the wait at once.
+func (l *Loader) waitForInitialLoad(ctx context.Context) error {
+	ready := l.readyChan()
+	isReady := func() bool {
+		select {
+		case <-ready:
+			return true
+		default:
+			return false
+		}
+	}
+	return poll(ctx, ready, func() bool {
+		if !isReady() {
+			l.reload()
+		}
+		return isReady()
+	}, l.notReady)
+}
+
+// poll calls done, backing off between calls, until it returns true or ctx is
+// done, in which case the error of ctx is passed to fail. Closing wake calls
+// done again without waiting out the delay.
+func poll(ctx context.Context, wake <-chan struct{}, done func() bool, fail func(error) error) error {
+	delay := minReadyPoll
+	for !done() {
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fail(ctx.Err())
+		case <-wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+		if delay *= 2; delay > maxReadyPoll {
+			delay = maxReadyPoll
+		}
+	}
+	return nil
+}
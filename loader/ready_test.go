@@ -0,0 +1,136 @@
+package loader
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lyft/goruntime/schema"
+	"github.com/lyft/goruntime/snapshot/entry"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWaitForInitialLoad(t *testing.T) {
+	assert := require.New(t)
+
+	tempDir, err := ioutil.TempDir("", "ready_test")
+	assert.NoError(err)
+	defer os.RemoveAll(tempDir)
+
+	// The directory is created after the loader starts waiting for it.
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		makeFileInDir(assert, tempDir+"/app/file1", "hello")
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	loader, err := New2(tempDir, "app", nullScope, &DirectoryRefresher{}, WaitForInitialLoad(ctx))
+	assert.NoError(err)
+	defer loader.(*Loader).Close()
+	assert.Equal("hello", loader.Snapshot().Get("file1"))
+	assert.NoError(loader.(*Loader).WaitReady(context.Background()))
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = New2(tempDir, "missing", nullScope, &DirectoryRefresher{}, WaitForInitialLoad(ctx))
+	assert.EqualError(err, "runtime is not ready: waiting for "+tempDir+"/missing: context deadline exceeded")
+	assert.True(errors.Is(err, context.DeadlineExceeded))
+
+	// An empty directory is not ready.
+	assert.NoError(os.Mkdir(tempDir+"/empty", 0755))
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = New2(tempDir, "empty", nullScope, &DirectoryRefresher{}, WaitForInitialLoad(ctx))
+	assert.EqualError(err, "runtime is not ready: context deadline exceeded")
+
+	// Nor is one missing a required key.
+	s := schema.New()
+	s.MustKey("file2", schema.Rule{Required: true})
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = New2(tempDir, "app", nullScope, &DirectoryRefresher{}, WithSchema(s), WaitForInitialLoad(ctx), WithLogger(NopLogger))
+	assert.Error(err)
+	assert.EqualError(err, "runtime is not ready: context deadline exceeded (missing required keys: file2)")
+
+	makeFileInDir(assert, tempDir+"/app/file2", "world")
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	loader, err = New2(tempDir, "app", nullScope, &DirectoryRefresher{}, WithSchema(s), WaitForInitialLoad(ctx))
+	assert.NoError(err)
+	defer loader.(*Loader).Close()
+	assert.Equal("world", loader.Snapshot().Get("file2"))
+}
+
+func TestWaitReady(t *testing.T) {
+	assert := require.New(t)
+
+	tempDir, err := ioutil.TempDir("", "ready_test")
+	assert.NoError(err)
+	defer os.RemoveAll(tempDir)
+	assert.NoError(os.MkdirAll(tempDir+"/app", 0755))
+
+	loader, err := New2(tempDir, "app", nullScope, &DirectoryRefresher{})
+	assert.NoError(err)
+	defer loader.(*Loader).Close()
+	l := loader.(*Loader)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.EqualError(l.WaitReady(ctx), "runtime is not ready: context deadline exceeded")
+
+	done := make(chan error)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		done <- l.WaitReady(ctx)
+	}()
+	makeFileInDir(assert, tempDir+"/app/file1", "hello")
+	assert.NoError(<-done)
+
+	// Once ready, the loader stays ready.
+	assert.NoError(os.Remove(tempDir + "/app/file1"))
+	assert.NoError(l.reload())
+	assert.NoError(l.WaitReady(context.Background()))
+}
+
+// flakySource fails to list its keys until it has been asked failures times.
+type flakySource struct {
+	failures int32
+	calls    int32
+}
+
+func (s *flakySource) Keys() ([]string, error) {
+	if atomic.AddInt32(&s.calls, 1) <= s.failures {
+		return nil, errors.New("not synced yet")
+	}
+	return []string{"key"}, nil
+}
+
+func (s *flakySource) Get(key string) (*entry.Entry, error) {
+	return entry.New("value", time.Time{}), nil
+}
+
+func (s *flakySource) Watch(stop <-chan struct{}, changed func()) error {
+	<-stop
+	return nil
+}
+
+func TestWaitForInitialLoadSource(t *testing.T) {
+	assert := require.New(t)
+
+	_, err := NewFromSource(&flakySource{failures: 1}, nullScope, WithLogger(NopLogger))
+	assert.EqualError(err, "unable to load runtime: not synced yet")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	source := &flakySource{failures: 3}
+	loader, err := NewFromSource(source, nullScope, WithLogger(NopLogger), WaitForInitialLoad(ctx))
+	assert.NoError(err)
+	defer loader.(*Loader).Close()
+	assert.Equal("value", loader.Snapshot().Get("key"))
+	assert.Equal(int32(4), atomic.LoadInt32(&source.calls))
+}
@@ -11,6 +11,21 @@ const (
 	Chmod
 )
 
+var fileSystemOpNames = map[FileSystemOp]string{
+	Create: "create",
+	Write:  "write",
+	Remove: "remove",
+	Rename: "rename",
+	Chmod:  "chmod",
+}
+
+func (op FileSystemOp) String() string {
+	if name, ok := fileSystemOpNames[op]; ok {
+		return name
+	}
+	return "unknown"
+}
+
 // A Refresher is used to determine when to refresh the runtime
 type Refresher interface {
 	// @return The directory path to watch for changes.
@@ -23,3 +38,59 @@ type Refresher interface {
 	// @param The Filesystem op that happened on the directory returned from WatchDirectory
 	ShouldRefresh(path string, op FileSystemOp) bool
 }
+
+// A PathWatcher is the set of paths being watched for a WatchRefresher. It is
+// safe for concurrent use.
+type PathWatcher interface {
+	// Add starts watching path. Adding a path that is already watched is a no-op.
+	Add(path string) error
+
+	// Remove stops watching path.
+	Remove(path string) error
+
+	// @return The paths currently being watched.
+	Paths() []string
+}
+
+// A WatchRefresher is a Refresher that manages its own set of watched paths,
+// which may change over time, and is told about watcher errors. It allows
+// recursive, symlink-chain and multi-root refresh strategies. Existing
+// Refreshers are converted with AdaptRefresher.
+type WatchRefresher interface {
+	// Watch is called once, before the initial load. The refresher adds the
+	// paths it needs to watcher, and may add or remove paths at any later
+	// time, for example from ShouldRefresh.
+	// @param runtimePath The root of the runtime path
+	// @param appDirPath Any app specific path
+	// @param watcher The set of watched paths
+	Watch(runtimePath string, appDirPath string, watcher PathWatcher) error
+
+	// @return If the runtime needs to be refreshed
+	// @param path The path that triggered the FileSystemOp
+	// @param The Filesystem op that happened on one of the watched paths
+	ShouldRefresh(path string, op FileSystemOp) bool
+
+	// WatchError is called with every error reported by the filesystem watcher.
+	WatchError(err error)
+}
+
+// AdaptRefresher converts r into a WatchRefresher that watches the single
+// directory returned by r.WatchDirectory. If r already implements
+// WatchRefresher it is returned unchanged.
+func AdaptRefresher(r Refresher) WatchRefresher {
+	if wr, ok := r.(WatchRefresher); ok {
+		return wr
+	}
+	return refresherAdapter{r}
+}
+
+type refresherAdapter struct {
+	Refresher
+}
+
+func (r refresherAdapter) Watch(runtimePath string, appDirPath string, watcher PathWatcher) error {
+	return watcher.Add(r.WatchDirectory(runtimePath, appDirPath))
+}
+
+// WatchError does nothing; the loader logs watcher errors itself.
+func (refresherAdapter) WatchError(err error) {}
@@ -0,0 +1,87 @@
+package loader
+
+import (
+	"os"
+	"time"
+)
+
+// Bounds of the delay between attempts to watch a removed path again.
+const (
+	minRewatchBackoff = 100 * time.Millisecond
+	maxRewatchBackoff = 10 * time.Second
+)
+
+// rewatcher watches paths again after they were removed or renamed, for
+// example by configuration management replacing a directory, retrying with
+// backoff until they reappear. It is only used from the watch loop.
+type rewatcher struct {
+	watcher *pathWatcher
+	lost    map[string]bool
+	backoff time.Duration
+	timer   *time.Timer
+}
+
+func newRewatcher(watcher *pathWatcher) *rewatcher {
+	return &rewatcher{watcher: watcher, lost: map[string]bool{}}
+}
+
+// C returns the channel that fires when it is time to call retry, or nil if
+// no path is lost.
+func (r *rewatcher) C() <-chan time.Time {
+	if r.timer == nil {
+		return nil
+	}
+	return r.timer.C
+}
+
+// lose stops watching path and schedules an attempt to watch it again.
+func (r *rewatcher) lose(path string) {
+	r.watcher.forget(path)
+	r.lost[path] = true
+	r.backoff = minRewatchBackoff
+	r.schedule()
+}
+
+// retry watches every lost path that exists again and returns them. Paths
+// that are still missing are retried later, backing off up to maxRewatchBackoff.
+func (r *rewatcher) retry() []string {
+	r.timer = nil
+
+	var recovered []string
+	for path := range r.lost {
+		if r.watcher.watches(path) {
+			// The refresher already watched it again.
+			delete(r.lost, path)
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		if err := r.watcher.Add(path); err != nil {
+			continue
+		}
+		delete(r.lost, path)
+		recovered = append(recovered, path)
+	}
+
+	if len(r.lost) > 0 {
+		if r.backoff *= 2; r.backoff > maxRewatchBackoff {
+			r.backoff = maxRewatchBackoff
+		}
+		r.schedule()
+	}
+	return recovered
+}
+
+func (r *rewatcher) schedule() {
+	if r.timer != nil {
+		r.timer.Stop()
+	}
+	r.timer = time.NewTimer(r.backoff)
+}
+
+func (r *rewatcher) stop() {
+	if r.timer != nil {
+		r.timer.Stop()
+	}
+}
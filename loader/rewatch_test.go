@@ -0,0 +1,61 @@
+package loader
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	stats "github.com/lyft/gostats"
+	"github.com/lyft/gostats/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRewatchReplacedDirectory(t *testing.T) {
+	assert := require.New(t)
+
+	tempDir, err := ioutil.TempDir("", "rewatch_test")
+	assert.NoError(err)
+	defer os.RemoveAll(tempDir)
+
+	makeFileInDir(assert, tempDir+"/app/file1", "first")
+
+	sink := mock.NewSink()
+	store := stats.NewStore(sink, false)
+	loader, err := New2(tempDir, "app", store.Scope("runtime"), &DirectoryRefresher{})
+	assert.NoError(err)
+	defer loader.(*Loader).Close()
+	runtime_update := make(chan int)
+	loader.AddUpdateCallback(runtime_update)
+
+	replaced := func(value string) {
+		select {
+		case <-runtime_update:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for a reload with file1 = %q", value)
+		}
+		for loader.Snapshot().Get("file1") != value {
+			select {
+			case <-runtime_update:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timed out waiting for file1 = %q, got %q", value, loader.Snapshot().Get("file1"))
+			}
+		}
+	}
+
+	// Renamed away and replaced.
+	assert.NoError(os.Rename(tempDir+"/app", tempDir+"/app.old"))
+	makeFileInDir(assert, tempDir+"/app/file1", "second")
+	replaced("second")
+
+	// Deleted and recreated, and then changed, which is only seen if the new
+	// directory is watched.
+	assert.NoError(os.RemoveAll(tempDir + "/app"))
+	makeFileInDir(assert, tempDir+"/app/file1", "third")
+	replaced("third")
+	makeFileInDir(assert, tempDir+"/app/file1", "fourth")
+	replaced("fourth")
+
+	store.Flush()
+	sink.AssertCounterEquals(t, "runtime.watch_recoveries", 2)
+}
@@ -0,0 +1,300 @@
+// Package rtds provides a loader.Source that subscribes to runtime layers from
+// an xDS control plane using Envoy's Runtime Discovery Service (RTDS), so Go
+// services consume the same runtime layers as the Envoys next to them.
+package rtds
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	discoveryv3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	runtimev3 "github.com/envoyproxy/go-control-plane/envoy/service/runtime/v3"
+	"github.com/lyft/goruntime/loader"
+	"github.com/lyft/goruntime/snapshot/entry"
+	"google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/sirupsen/logrus"
+)
+
+// TypeURL is the xDS type of runtime layer resources.
+const TypeURL = "type.googleapis.com/envoy.service.runtime.v3.Runtime"
+
+// VersionMetadataKey is the snapshot metadata key holding the last accepted
+// xDS version_info.
+const VersionMetadataKey = "rtds.version"
+
+// Default reconnect backoff.
+const (
+	DefaultMinBackoff = 100 * time.Millisecond
+	DefaultMaxBackoff = 30 * time.Second
+)
+
+// Source is a loader.Source that streams runtime layers over RTDS. Layers are
+// applied in the order they were subscribed to, so a key in a later layer
+// overrides the same key in an earlier one. Nested structs in a layer are
+// flattened into dotted keys, as Envoy does.
+type Source struct {
+	client runtimev3.RuntimeDiscoveryServiceClient
+	node   *corev3.Node
+	layers []string
+
+	// MinBackoff and MaxBackoff bound the delay before reconnecting a failed stream.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	mu      sync.Mutex
+	version string
+	applied map[string]map[string]*entry.Entry
+	merged  map[string]*entry.Entry
+
+	logger loader.Logger
+}
+
+// NewSource creates a Source that subscribes to layers over conn, identifying
+// itself to the control plane as node.
+func NewSource(conn grpc.ClientConnInterface, node *corev3.Node, layers ...string) *Source {
+	return &Source{
+		client:     runtimev3.NewRuntimeDiscoveryServiceClient(conn),
+		node:       node,
+		layers:     layers,
+		MinBackoff: DefaultMinBackoff,
+		MaxBackoff: DefaultMaxBackoff,
+		applied:    map[string]map[string]*entry.Entry{},
+		logger:     loader.NewLogrusLogger(logrus.StandardLogger()),
+	}
+}
+
+// SetLogger implements loader.LoggerSetter, so the source logs through the
+// Logger of the loader it is passed to. It must be called before the source
+// is used.
+func (s *Source) SetLogger(logger loader.Logger) { s.logger = logger }
+
+// Keys returns the keys of every layer received so far. Until the control
+// plane has sent a layer, it contributes no keys.
+func (s *Source) Keys() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.merged = map[string]*entry.Entry{}
+	for _, layer := range s.layers {
+		for key, e := range s.applied[layer] {
+			s.merged[key] = e
+		}
+	}
+
+	keys := make([]string, 0, len(s.merged))
+	for key := range s.merged {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (s *Source) Get(key string) (*entry.Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.merged[key]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return e, nil
+}
+
+func (s *Source) Metadata() map[string]string {
+	return map[string]string{VersionMetadataKey: s.Version()}
+}
+
+// Version returns the version_info of the last accepted response.
+func (s *Source) Version() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.version
+}
+
+func (s *Source) Watch(stop <-chan struct{}, changed func()) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	backoff := s.MinBackoff
+	for {
+		accepted, err := s.stream(ctx, changed)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if accepted {
+			backoff = s.MinBackoff
+		}
+		s.logger.Warn("runtime: rtds stream failed, reconnecting",
+			loader.Field{Key: "backoff", Value: backoff.String()}, loader.Field{Key: loader.FieldError, Value: err})
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > s.MaxBackoff {
+			backoff = s.MaxBackoff
+		}
+	}
+}
+
+// stream runs one RTDS stream until it fails, reporting whether any response
+// was accepted on it.
+func (s *Source) stream(ctx context.Context, changed func()) (accepted bool, err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := s.client.StreamRuntime(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	// Resuming with the last accepted version lets the control plane skip
+	// resending layers we already have.
+	err = stream.Send(&discoveryv3.DiscoveryRequest{
+		VersionInfo:   s.Version(),
+		Node:          s.node,
+		ResourceNames: s.layers,
+		TypeUrl:       TypeURL,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			return accepted, err
+		}
+
+		req := &discoveryv3.DiscoveryRequest{
+			Node:          s.node,
+			ResourceNames: s.layers,
+			TypeUrl:       TypeURL,
+			ResponseNonce: resp.GetNonce(),
+		}
+		if err := s.apply(resp); err != nil {
+			s.logger.Warn("runtime: rejecting rtds version",
+				loader.Field{Key: "version", Value: resp.GetVersionInfo()}, loader.Field{Key: loader.FieldError, Value: err})
+			req.VersionInfo = s.Version()
+			req.ErrorDetail = &status.Status{
+				Code:    int32(codes.InvalidArgument),
+				Message: err.Error(),
+			}
+		} else {
+			accepted = true
+			req.VersionInfo = resp.GetVersionInfo()
+		}
+
+		if err := stream.Send(req); err != nil {
+			return accepted, err
+		}
+		if req.ErrorDetail == nil {
+			changed()
+		}
+	}
+}
+
+// apply decodes every layer in resp and, only if all of them are valid,
+// replaces the corresponding layers.
+func (s *Source) apply(resp *discoveryv3.DiscoveryResponse) error {
+	if resp.GetTypeUrl() != TypeURL {
+		return fmt.Errorf("unexpected type %q", resp.GetTypeUrl())
+	}
+
+	subscribed := make(map[string]bool, len(s.layers))
+	for _, layer := range s.layers {
+		subscribed[layer] = true
+	}
+
+	now := time.Now()
+	layers := map[string]map[string]*entry.Entry{}
+	for _, resource := range resp.GetResources() {
+		runtime := &runtimev3.Runtime{}
+		if err := resource.UnmarshalTo(runtime); err != nil {
+			return fmt.Errorf("decoding resource: %s", err)
+		}
+		if !subscribed[runtime.GetName()] {
+			return fmt.Errorf("unexpected layer %q", runtime.GetName())
+		}
+
+		entries := map[string]*entry.Entry{}
+		if err := flatten("", runtime.GetLayer(), now, entries); err != nil {
+			return fmt.Errorf("layer %q: %s", runtime.GetName(), err)
+		}
+		layers[runtime.GetName()] = entries
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name, entries := range layers {
+		s.applied[name] = entries
+	}
+	s.version = resp.GetVersionInfo()
+	return nil
+}
+
+func flatten(prefix string, layer *structpb.Struct, modified time.Time, entries map[string]*entry.Entry) error {
+	names := make([]string, 0, len(layer.GetFields()))
+	for name := range layer.GetFields() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+
+		switch v := layer.GetFields()[name].GetKind().(type) {
+		case *structpb.Value_StructValue:
+			if err := flatten(key, v.StructValue, modified, entries); err != nil {
+				return err
+			}
+		case *structpb.Value_StringValue:
+			entries[key] = entry.New(v.StringValue, modified)
+		case *structpb.Value_NumberValue:
+			entries[key] = numberEntry(v.NumberValue, modified)
+		case *structpb.Value_BoolValue:
+			entries[key] = entry.New(strconv.FormatBool(v.BoolValue), modified)
+		case *structpb.Value_NullValue:
+			// A null value removes the key from this layer.
+		default:
+			return fmt.Errorf("key %q: unsupported value %T", key, v)
+		}
+	}
+	return nil
+}
+
+// numberEntry converts a JSON number. Struct numbers are doubles, so only whole,
+// non-negative numbers that fit in a uint64 are treated as integers.
+func numberEntry(n float64, modified time.Time) *entry.Entry {
+	if n >= 0 && n < math.MaxUint64 && n == math.Trunc(n) {
+		u := uint64(n)
+		return &entry.Entry{
+			StringValue: strconv.FormatUint(u, 10),
+			Uint64Value: u,
+			Uint64Valid: true,
+			Modified:    modified,
+		}
+	}
+	return entry.New(strconv.FormatFloat(n, 'g', -1, 64), modified)
+}
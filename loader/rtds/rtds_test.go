@@ -0,0 +1,258 @@
+package rtds_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	discoveryv3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	runtimev3 "github.com/envoyproxy/go-control-plane/envoy/service/runtime/v3"
+	"github.com/lyft/goruntime/loader"
+	"github.com/lyft/goruntime/loader/rtds"
+	"github.com/lyft/goruntime/snapshot"
+	stats "github.com/lyft/gostats"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+var nullScope = stats.NewStore(stats.NewNullSink(), false)
+
+const timeout = 3 * time.Second
+
+// server is an RTDS control plane that hands each stream to the test.
+type server struct {
+	runtimev3.UnimplementedRuntimeDiscoveryServiceServer
+	streams chan *stream
+}
+
+type stream struct {
+	runtimev3.RuntimeDiscoveryService_StreamRuntimeServer
+	requests chan *discoveryv3.DiscoveryRequest
+	done     chan struct{}
+}
+
+func (s *server) StreamRuntime(srv runtimev3.RuntimeDiscoveryService_StreamRuntimeServer) error {
+	st := &stream{
+		RuntimeDiscoveryService_StreamRuntimeServer: srv,
+		requests: make(chan *discoveryv3.DiscoveryRequest, 16),
+		done:     make(chan struct{}),
+	}
+	go func() {
+		for {
+			req, err := srv.Recv()
+			if err != nil {
+				return
+			}
+			st.requests <- req
+		}
+	}()
+	s.streams <- st
+	select {
+	case <-st.done:
+	case <-srv.Context().Done():
+	}
+	return nil
+}
+
+func startServer(t *testing.T) (*server, *grpc.ClientConn, func()) {
+	listener := bufconn.Listen(1 << 20)
+	srv := &server{streams: make(chan *stream, 4)}
+	grpcServer := grpc.NewServer()
+	runtimev3.RegisterRuntimeDiscoveryServiceServer(grpcServer, srv)
+	go grpcServer.Serve(listener)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithInsecure(),
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }),
+	)
+	require.NoError(t, err)
+	return srv, conn, func() {
+		conn.Close()
+		grpcServer.Stop()
+	}
+}
+
+func (s *server) nextStream(t *testing.T) *stream {
+	select {
+	case st := <-s.streams:
+		return st
+	case <-time.After(timeout):
+		t.Fatal("no stream opened")
+		return nil
+	}
+}
+
+func (st *stream) nextRequest(t *testing.T) *discoveryv3.DiscoveryRequest {
+	select {
+	case req := <-st.requests:
+		return req
+	case <-time.After(timeout):
+		t.Fatal("no request received")
+		return nil
+	}
+}
+
+func (st *stream) respond(t *testing.T, version string, nonce string, layers map[string]map[string]interface{}) {
+	resp := &discoveryv3.DiscoveryResponse{
+		VersionInfo: version,
+		Nonce:       nonce,
+		TypeUrl:     rtds.TypeURL,
+	}
+	for name, fields := range layers {
+		layer, err := structpb.NewStruct(fields)
+		require.NoError(t, err)
+		resource, err := anypb.New(&runtimev3.Runtime{Name: name, Layer: layer})
+		require.NoError(t, err)
+		resp.Resources = append(resp.Resources, resource)
+	}
+	require.NoError(t, st.Send(resp))
+}
+
+func waitForUpdate(t *testing.T, update <-chan int) {
+	select {
+	case <-update:
+	case <-time.After(timeout):
+		t.Fatalf("no update after %s", timeout)
+	}
+}
+
+func TestSource(t *testing.T) {
+	assert := require.New(t)
+
+	srv, conn, stop := startServer(t)
+	defer stop()
+
+	node := &corev3.Node{Id: "test-node", Cluster: "test"}
+	source := rtds.NewSource(conn, node, "base", "override")
+	source.MinBackoff = time.Millisecond
+
+	l, err := loader.NewFromSource(source, nullScope)
+	assert.NoError(err)
+	defer l.(*loader.Loader).Close()
+	update := make(chan int, 1)
+	l.AddUpdateCallback(update)
+	assert.Empty(l.Snapshot().Keys())
+
+	st := srv.nextStream(t)
+	req := st.nextRequest(t)
+	assert.Equal(rtds.TypeURL, req.GetTypeUrl())
+	assert.Equal([]string{"base", "override"}, req.GetResourceNames())
+	assert.Equal("test-node", req.GetNode().GetId())
+	assert.Equal("", req.GetVersionInfo())
+
+	st.respond(t, "v1", "n1", map[string]map[string]interface{}{
+		"base": {
+			"name":    "value",
+			"feature": map[string]interface{}{"enabled": 25, "ratio": 0.5},
+			"flag":    true,
+		},
+		"override": {"name": "overridden"},
+	})
+	ack := st.nextRequest(t)
+	assert.Equal("v1", ack.GetVersionInfo())
+	assert.Equal("n1", ack.GetResponseNonce())
+	assert.Nil(ack.GetErrorDetail())
+	waitForUpdate(t, update)
+
+	s := l.Snapshot()
+	assert.Equal("overridden", s.Get("name"))
+	assert.Equal(uint64(25), s.GetInteger("feature.enabled", 0))
+	assert.Equal("0.5", s.Get("feature.ratio"))
+	assert.Equal(uint64(7), s.GetInteger("feature.ratio", 7))
+	assert.Equal("true", s.Get("flag"))
+	assert.Equal("v1", snapshot.Metadata(s)[rtds.VersionMetadataKey])
+
+	// Lists are not valid runtime values, so the whole response is rejected.
+	st.respond(t, "v2", "n2", map[string]map[string]interface{}{
+		"base": {"name": "value2", "list": []interface{}{1, 2}},
+	})
+	nack := st.nextRequest(t)
+	assert.Equal("v1", nack.GetVersionInfo())
+	assert.Equal("n2", nack.GetResponseNonce())
+	assert.NotNil(nack.GetErrorDetail())
+	assert.Equal("v1", source.Version())
+
+	// Layers not in a response are left untouched.
+	st.respond(t, "v3", "n3", map[string]map[string]interface{}{
+		"override": {"other": 3},
+	})
+	assert.Equal("v3", st.nextRequest(t).GetVersionInfo())
+	waitForUpdate(t, update)
+	s = l.Snapshot()
+	assert.Equal("value", s.Get("name"))
+	assert.Equal(uint64(3), s.GetInteger("other", 0))
+	assert.Equal(uint64(25), s.GetInteger("feature.enabled", 0))
+
+	// After the stream drops the client reconnects and resumes from the last
+	// accepted version.
+	close(st.done)
+	st = srv.nextStream(t)
+	req = st.nextRequest(t)
+	assert.Equal("v3", req.GetVersionInfo())
+	assert.Equal("", req.GetResponseNonce())
+	assert.Equal("value", l.Snapshot().Get("name"))
+}
+
+func TestSource_UnknownLayer(t *testing.T) {
+	assert := require.New(t)
+
+	srv, conn, stop := startServer(t)
+	defer stop()
+
+	source := rtds.NewSource(conn, &corev3.Node{Id: "test-node"}, "base")
+	stopWatch := make(chan struct{})
+	done := make(chan error)
+	go func() { done <- source.Watch(stopWatch, func() {}) }()
+
+	st := srv.nextStream(t)
+	st.nextRequest(t)
+	st.respond(t, "v1", "n1", map[string]map[string]interface{}{"unknown": {"name": "value"}})
+	nack := st.nextRequest(t)
+	assert.NotNil(nack.GetErrorDetail())
+	assert.Equal("", nack.GetVersionInfo())
+
+	close(stopWatch)
+	select {
+	case err := <-done:
+		assert.NoError(err)
+	case <-time.After(timeout):
+		t.Fatal("watch did not stop")
+	}
+}
+
+func TestSourceWaitForInitialLoad(t *testing.T) {
+	assert := require.New(t)
+
+	srv, conn, stop := startServer(t)
+	defer stop()
+
+	source := rtds.NewSource(conn, &corev3.Node{Id: "test-node"}, "base")
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// Layers only arrive over the stream, which the loader must open while it
+	// waits for them.
+	type result struct {
+		l   loader.IFace
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		l, err := loader.NewFromSource(source, nullScope, loader.WaitForInitialLoad(ctx))
+		done <- result{l, err}
+	}()
+
+	st := srv.nextStream(t)
+	st.nextRequest(t)
+	st.respond(t, "v1", "n1", map[string]map[string]interface{}{"base": {"name": "value"}})
+
+	r := <-done
+	assert.NoError(r.err)
+	defer r.l.(*loader.Loader).Close()
+	assert.Equal("value", r.l.Snapshot().Get("name"))
+}
@@ -0,0 +1,74 @@
+package loader
+
+import (
+	"time"
+
+	"github.com/lyft/goruntime/schema"
+	"github.com/lyft/goruntime/snapshot"
+	"github.com/lyft/goruntime/snapshot/entry"
+)
+
+// WithSchema validates every snapshot against s before it is published. What
+// happens to an invalid value, or a missing required key, is decided by the
+// OnInvalid policy of its rule. Every violation is logged, counted in the
+// validation_errors stat and listed in the loader's Status.
+func WithSchema(s *schema.Schema) Option {
+	return func(l *Loader) { l.schema = s }
+}
+
+// validateEntry checks e against the schema and returns the entry to publish
+// for key, or nil if the key should be left out of the snapshot.
+func (l *Loader) validateEntry(key string, e *entry.Entry) *entry.Entry {
+	err := l.schema.Validate(key, e.StringValue)
+	if err == nil {
+		return e
+	}
+	return l.resolveInvalid(err, e, e.Modified)
+}
+
+// validateRequired resolves every required key missing from next.
+func (l *Loader) validateRequired(next *snapshot.Snapshot) {
+	for _, err := range l.schema.Missing(next) {
+		if e := l.resolveInvalid(err, nil, time.Time{}); e != nil {
+			next.SetEntry(err.Key, e)
+		}
+	}
+}
+
+func (l *Loader) resolveInvalid(err *schema.Error, e *entry.Entry, modified time.Time) *entry.Entry {
+	l.stats.validationErrors.Inc()
+	l.pending.ValidationErrors = append(l.pending.ValidationErrors, err)
+
+	switch err.Policy {
+	case schema.RejectSnapshot:
+		l.log().Warn("runtime: invalid value, rejecting snapshot", keyField(err.Key), errorField(err))
+		return e
+	case schema.KeepPrevious:
+		if current := l.Snapshot(); current != nil {
+			if previous, ok := current.Entries()[err.Key]; ok {
+				l.log().Warn("runtime: invalid value, keeping previous value", keyField(err.Key), errorField(err))
+				return previous
+			}
+		}
+	}
+
+	rule, _ := l.schema.Lookup(err.Key)
+	if rule.Default == "" {
+		l.log().Warn("runtime: invalid value, ignoring key", keyField(err.Key), errorField(err))
+		return nil
+	}
+	l.log().Warn("runtime: invalid value, using default", keyField(err.Key), errorField(err), Field{Key: "default", Value: rule.Default})
+	return entry.New(rule.Default, modified)
+}
+
+// rejectedBySchema returns the validation errors of the reload in progress
+// whose rules reject the whole snapshot.
+func (l *Loader) rejectedBySchema() schema.Errors {
+	var rejected schema.Errors
+	for _, err := range l.pending.ValidationErrors {
+		if err.Policy == schema.RejectSnapshot {
+			rejected = append(rejected, err)
+		}
+	}
+	return rejected
+}
@@ -0,0 +1,82 @@
+package loader
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/lyft/goruntime/schema"
+	stats "github.com/lyft/gostats"
+	"github.com/lyft/gostats/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// manualRefresher never refreshes, leaving reloads to the test.
+type manualRefresher struct {
+	DirectoryRefresher
+}
+
+func (manualRefresher) ShouldRefresh(path string, op FileSystemOp) bool { return false }
+
+func TestWithSchema(t *testing.T) {
+	assert := require.New(t)
+
+	tempDir, err := ioutil.TempDir("", "schema_test")
+	assert.NoError(err)
+	defer os.RemoveAll(tempDir)
+
+	makeFileInDir(assert, tempDir+"/app/timeout_ms", "250")
+	makeFileInDir(assert, tempDir+"/app/retries", "3")
+	makeFileInDir(assert, tempDir+"/app/mode", "fast")
+	makeFileInDir(assert, tempDir+"/app/limit", "10")
+
+	s := schema.New().
+		MustKey("timeout_ms", schema.Rule{Type: schema.Integer, Max: schema.Bound(1000), Default: "100"}).
+		MustKey("retries", schema.Rule{Type: schema.Integer, OnInvalid: schema.KeepPrevious}).
+		MustKey("mode", schema.Rule{Enum: []string{"fast", "safe"}}).
+		MustKey("limit", schema.Rule{Type: schema.Integer, Required: true, OnInvalid: schema.RejectSnapshot}).
+		MustKey("region", schema.Rule{Required: true, Default: "us-east-1"})
+
+	sink := mock.NewSink()
+	store := stats.NewStore(sink, false)
+	loader, err := New2(tempDir, "app", store.Scope("runtime"), &manualRefresher{}, WithSchema(s))
+	assert.NoError(err)
+	defer loader.(*Loader).Close()
+	l := loader.(*Loader)
+
+	snapshot := l.Snapshot()
+	assert.Equal(uint64(250), snapshot.GetInteger("timeout_ms", 0))
+	assert.Equal("us-east-1", snapshot.Get("region"))
+	assert.Equal(schema.Errors{
+		{Key: "region", Reason: "required key is missing"},
+	}, l.Status().ValidationErrors)
+
+	makeFileInDir(assert, tempDir+"/app/timeout_ms", "5000")
+	makeFileInDir(assert, tempDir+"/app/retries", "three")
+	makeFileInDir(assert, tempDir+"/app/mode", "reckless")
+	l.onRuntimeChanged()
+
+	snapshot = l.Snapshot()
+	assert.Equal(uint64(100), snapshot.GetInteger("timeout_ms", 0))
+	assert.Equal(uint64(3), snapshot.GetInteger("retries", 0))
+	assert.NotContains(snapshot.Entries(), "mode")
+	assert.Len(l.Status().ValidationErrors, 4)
+	assert.NoError(l.Status().LastError)
+
+	// An invalid value for a rejecting rule keeps the current snapshot.
+	makeFileInDir(assert, tempDir+"/app/limit", "ten")
+	l.onRuntimeChanged()
+	assert.Equal(snapshot, l.Snapshot())
+	status := l.Status()
+	assert.IsType(schema.Errors{}, status.LastError)
+	assert.Equal("runtime key limit: not an integer", status.LastError.Error())
+
+	os.Remove(tempDir + "/app/limit")
+	l.onRuntimeChanged()
+	assert.Equal(snapshot, l.Snapshot())
+	assert.Equal("runtime key limit: required key is missing", l.Status().LastError.Error())
+
+	store.Flush()
+	sink.AssertCounterEquals(t, "runtime.validation_errors", 1+4+5+5)
+	sink.AssertCounterEquals(t, "runtime.load_rejections", 2)
+}
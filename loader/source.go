@@ -0,0 +1,29 @@
+package loader
+
+import "github.com/lyft/goruntime/snapshot/entry"
+
+// A Source supplies the keys and values that a Loader builds snapshots from.
+type Source interface {
+	// @return All of the runtime keys currently held by the source.
+	Keys() ([]string, error)
+
+	// @return The entry stored under key. Get is only called for keys returned
+	//         by the immediately preceding call to Keys, so a source may serve
+	//         it from that listing.
+	// @param key supplies the key to fetch.
+	Get(key string) (*entry.Entry, error)
+
+	// Watch blocks, calling changed each time the source moves to a new
+	// revision, until stop is closed. A nil stop channel watches forever.
+	// @param stop supplies the channel that ends the watch when closed.
+	// @param changed supplies the function to call after every change.
+	Watch(stop <-chan struct{}, changed func()) error
+}
+
+// A MetadataSource is a Source that describes the revision it last listed.
+type MetadataSource interface {
+	Source
+
+	// @return Metadata recorded in the snapshot built from the last call to Keys.
+	Metadata() map[string]string
+}
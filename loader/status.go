@@ -0,0 +1,114 @@
+package loader
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lyft/goruntime/schema"
+)
+
+// Status describes the current snapshot of a Loader and the outcome of its
+// most recent reload. Slices in a Status are shared and must not be modified.
+type Status struct {
+	// LoadedAt is when the current snapshot was published.
+	LoadedAt time.Time
+	// NumValues is the number of keys in the current snapshot.
+	NumValues int
+	// LastError is set if the most recent reload was rejected, in which case
+	// the previous snapshot is still current.
+	LastError error
+	// KeyCollisions lists runtime keys that more than one file mapped to in the
+	// most recent reload. Only the last of those files, in walk order, was loaded.
+	KeyCollisions []KeyCollision
+	// LimitViolations lists the files that exceeded a limit in the most recent reload.
+	LimitViolations []LimitViolation
+	// PathViolations lists the files that were not read in the most recent
+	// reload because they resolved outside the runtime root.
+	PathViolations []PathViolation
+	// ValidationErrors lists the values that failed schema validation, and the
+	// required keys that were missing, in the most recent reload.
+	ValidationErrors schema.Errors
+	// FileErrors lists the files that could not be read in the most recent reload.
+	FileErrors []FileError
+}
+
+// FileError is a runtime file that could not be read.
+type FileError struct {
+	Path string
+	Err  error
+}
+
+func (e FileError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Err)
+}
+
+// KeyCollision is a runtime key that more than one file mapped to.
+type KeyCollision struct {
+	Key string
+	// Paths are the colliding files in walk order, the loaded one last.
+	Paths []string
+}
+
+// LoadStats are the totals of the loader's load stats since it was created.
+type LoadStats struct {
+	// LoadAttempts counts reloads attempted, and LoadFailures the files or
+	// keys that could not be loaded and the reloads that failed.
+	LoadAttempts uint64
+	LoadFailures uint64
+	// LoadRejections counts reloads rejected for exceeding a limit or failing
+	// schema validation.
+	LoadRejections uint64
+	// KeyCollisions counts files that mapped to a key another file already had.
+	KeyCollisions uint64
+}
+
+// LoadStats returns the totals of the load_attempts, load_failures,
+// load_rejections and key_collisions stats.
+func (l *Loader) LoadStats() LoadStats {
+	return LoadStats{
+		LoadAttempts:   l.stats.loadAttempts.Total(),
+		LoadFailures:   l.stats.loadFailures.Total(),
+		LoadRejections: l.stats.loadRejections.Total(),
+		KeyCollisions:  l.stats.keyCollisions.Total(),
+	}
+}
+
+// Status returns the status of the current snapshot and the most recent reload.
+func (l *Loader) Status() Status {
+	l.statusMu.RLock()
+	defer l.statusMu.RUnlock()
+	return l.status
+}
+
+// Problems describes every collision, violation and error of the most recent
+// reload, other than LastError, in a form suitable for showing to operators.
+func (s Status) Problems() []string {
+	var problems []string
+	for _, c := range s.KeyCollisions {
+		problems = append(problems, fmt.Sprintf("key %s collides: %s", c.Key, strings.Join(c.Paths, ", ")))
+	}
+	for _, v := range s.LimitViolations {
+		problems = append(problems, v.Error())
+	}
+	for _, v := range s.PathViolations {
+		problems = append(problems, fmt.Sprintf("%s resolves outside the runtime root to %s", v.Path, v.Target))
+	}
+	for _, err := range s.ValidationErrors {
+		problems = append(problems, err.Error())
+	}
+	for _, err := range s.FileErrors {
+		problems = append(problems, err.Error())
+	}
+	return problems
+}
+
+func (s *Status) addCollision(key string, replaced string, loaded string) {
+	for i := range s.KeyCollisions {
+		if s.KeyCollisions[i].Key == key {
+			s.KeyCollisions[i].Paths = append(s.KeyCollisions[i].Paths, loaded)
+			return
+		}
+	}
+	s.KeyCollisions = append(s.KeyCollisions, KeyCollision{Key: key, Paths: []string{replaced, loaded}})
+}
@@ -0,0 +1,133 @@
+package loader
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/lyft/goruntime/snapshot"
+)
+
+// An Update is delivered to subscribers when a loader publishes a snapshot.
+type Update struct {
+	// Snapshot is the snapshot that was published.
+	Snapshot snapshot.IFace
+	// Previous is the snapshot it replaced, or nil for the first update of a
+	// subscription.
+	Previous snapshot.IFace
+	// Generation is the loader's Generation once Snapshot was published.
+	Generation uint64
+}
+
+// A Subscription delivers updates until it is unsubscribed.
+type Subscription struct {
+	loader *Loader
+	fn     func(Update)
+	// active is 1 until Unsubscribe is called, accessed atomically.
+	active int32
+}
+
+type subscriptions struct {
+	mu   sync.Mutex
+	subs []*Subscription
+}
+
+func (s *subscriptions) add(sub *Subscription) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subs = append(s.subs, sub)
+}
+
+func (s *subscriptions) remove(sub *Subscription) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.subs {
+		if s.subs[i] == sub {
+			// Copy rather than modify in place, as deliveries iterate over the
+			// slice without holding the lock.
+			s.subs = append(s.subs[:i:i], s.subs[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *subscriptions) list() []*Subscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.subs
+}
+
+// Subscribe calls fn with the current snapshot, if there is one, and then with
+// every snapshot the loader publishes until the subscription is unsubscribed.
+//
+// Updates are delivered in the order snapshots are published, each exactly
+// once, and never concurrently: fn is called on the goroutine that reloads the
+// runtime, so the next reload waits for it to return. fn should therefore be
+// quick, handing any slow work to another goroutine, and must not call
+// Subscribe itself. A panic in fn is recovered, logged and counted in the
+// subscriber_panics stat, and does not affect other subscribers.
+func (l *Loader) Subscribe(fn func(Update)) *Subscription {
+	if fn == nil {
+		panic("goruntime/loader: nil subscriber")
+	}
+	sub := &Subscription{loader: l, fn: fn, active: 1}
+
+	// Holding mu keeps reloads from publishing between the current snapshot
+	// being delivered and the subscription being added.
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if current := l.Snapshot(); current != nil {
+		sub.deliver(Update{Snapshot: current, Generation: l.Generation()})
+	}
+	l.subscriptions.add(sub)
+	return sub
+}
+
+// SubscribeChan is like Subscribe but sends updates to ch. Sends never block:
+// if ch is full the update is dropped and counted in the callbacks_dropped
+// stat, so ch should be buffered. When updates may be dropped, compare each
+// snapshot received with the previous one received rather than with Previous.
+// ch is not closed when the subscription is unsubscribed.
+func (l *Loader) SubscribeChan(ch chan<- Update) *Subscription {
+	if ch == nil {
+		panic("goruntime/loader: nil subscriber")
+	}
+	return l.Subscribe(func(u Update) {
+		select {
+		case ch <- u:
+		default:
+			l.stats.callbacksDropped.Inc()
+		}
+	})
+}
+
+// Unsubscribe stops the delivery of updates. An update that is already being
+// delivered may still arrive. It is safe to call Unsubscribe more than once,
+// and from within the subscriber.
+func (s *Subscription) Unsubscribe() {
+	if atomic.CompareAndSwapInt32(&s.active, 1, 0) {
+		s.loader.subscriptions.remove(s)
+	}
+}
+
+func (s *Subscription) deliver(u Update) {
+	if atomic.LoadInt32(&s.active) == 0 {
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			s.loader.stats.subscriberPanics.Inc()
+			s.loader.log().Error("runtime: update subscriber panicked", Field{Key: "panic", Value: fmt.Sprint(r)})
+		}
+	}()
+	s.fn(u)
+}
+
+// notifySubscribers delivers the publication of next, which replaced
+// previous, to every subscriber. It is called with mu held.
+func (l *Loader) notifySubscribers(next snapshot.IFace, previous snapshot.IFace) {
+	u := Update{Snapshot: next, Previous: previous, Generation: l.Generation()}
+	for _, sub := range l.subscriptions.list() {
+		sub.deliver(u)
+	}
+}
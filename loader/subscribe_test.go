@@ -0,0 +1,124 @@
+package loader
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	stats "github.com/lyft/gostats"
+	"github.com/lyft/gostats/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscribe(t *testing.T) {
+	assert := require.New(t)
+
+	tempDir, err := ioutil.TempDir("", "subscribe_test")
+	assert.NoError(err)
+	defer os.RemoveAll(tempDir)
+	makeFileInDir(assert, tempDir+"/app/file1", "hello")
+
+	sink := mock.NewSink()
+	store := stats.NewStore(sink, false)
+	loader, err := New2(tempDir, "app", store.Scope("runtime"), &manualRefresher{}, WithLogger(NopLogger))
+	assert.NoError(err)
+	defer loader.(*Loader).Close()
+	l := loader.(*Loader)
+
+	// The current snapshot is delivered first, then every later one in order.
+	var updates []Update
+	sub := l.Subscribe(func(u Update) { updates = append(updates, u) })
+	assert.Len(updates, 1)
+	assert.Equal("hello", updates[0].Snapshot.Get("file1"))
+	assert.Nil(updates[0].Previous)
+	assert.Equal(l.Generation(), updates[0].Generation)
+
+	// A panicking subscriber does not affect the others.
+	panicking := l.Subscribe(func(u Update) { panic("boom") })
+
+	makeFileInDir(assert, tempDir+"/app/file1", "world")
+	assert.NoError(l.reload())
+	makeFileInDir(assert, tempDir+"/app/file1", "again")
+	assert.NoError(l.reload())
+	assert.Len(updates, 3)
+	assert.Equal("world", updates[1].Snapshot.Get("file1"))
+	assert.Equal(updates[0].Snapshot, updates[1].Previous)
+	assert.Equal("again", updates[2].Snapshot.Get("file1"))
+	assert.Equal(updates[1].Snapshot, updates[2].Previous)
+	assert.Equal(updates[1].Generation+1, updates[2].Generation)
+
+	sub.Unsubscribe()
+	sub.Unsubscribe()
+	panicking.Unsubscribe()
+	assert.NoError(l.reload())
+	assert.Len(updates, 3)
+
+	store.Flush()
+	// Including the delivery of the current snapshot on subscribing.
+	sink.AssertCounterEquals(t, "runtime.subscriber_panics", 3)
+}
+
+func TestSubscribeUnsubscribeFromSubscriber(t *testing.T) {
+	assert := require.New(t)
+
+	tempDir, err := ioutil.TempDir("", "subscribe_test")
+	assert.NoError(err)
+	defer os.RemoveAll(tempDir)
+	makeFileInDir(assert, tempDir+"/app/file1", "hello")
+
+	loader, err := New2(tempDir, "app", nullScope, &manualRefresher{})
+	assert.NoError(err)
+	defer loader.(*Loader).Close()
+	l := loader.(*Loader)
+
+	calls := 0
+	var sub *Subscription
+	sub = l.Subscribe(func(u Update) {
+		calls++
+		if calls == 2 {
+			sub.Unsubscribe()
+		}
+	})
+	other := 0
+	l.Subscribe(func(u Update) { other++ })
+	for i := 0; i < 3; i++ {
+		assert.NoError(l.reload())
+	}
+	assert.Equal(2, calls)
+	assert.Equal(4, other)
+}
+
+func TestSubscribeChan(t *testing.T) {
+	assert := require.New(t)
+
+	tempDir, err := ioutil.TempDir("", "subscribe_test")
+	assert.NoError(err)
+	defer os.RemoveAll(tempDir)
+	makeFileInDir(assert, tempDir+"/app/file1", "hello")
+
+	sink := mock.NewSink()
+	store := stats.NewStore(sink, false)
+	loader, err := New2(tempDir, "app", store.Scope("runtime"), &manualRefresher{})
+	assert.NoError(err)
+	defer loader.(*Loader).Close()
+	l := loader.(*Loader)
+
+	ch := make(chan Update, 2)
+	sub := l.SubscribeChan(ch)
+	makeFileInDir(assert, tempDir+"/app/file1", "world")
+	assert.NoError(l.reload())
+	// The channel is full, so this update is dropped.
+	assert.NoError(l.reload())
+
+	u := <-ch
+	assert.Equal("hello", u.Snapshot.Get("file1"))
+	u = <-ch
+	assert.Equal("world", u.Snapshot.Get("file1"))
+	assert.Equal("hello", u.Previous.Get("file1"))
+	store.Flush()
+	sink.AssertCounterEquals(t, "runtime.callbacks_dropped", 1)
+
+	sub.Unsubscribe()
+	assert.NoError(l.reload())
+	assert.Len(ch, 0)
+}
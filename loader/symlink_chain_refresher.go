@@ -0,0 +1,169 @@
+package loader
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// maxSymlinkHops bounds symlink resolution, guarding against loops.
+const maxSymlinkHops = 255
+
+// SymlinkChainRefresher watches a runtime path that is reached through one or
+// more symlinks, possibly relative and possibly in different directories,
+// such as the "..data -> ..2024_01_01" link Kubernetes uses for ConfigMap
+// volumes. Every directory holding a link in the chain is watched and the
+// runtime is refreshed whenever the path the chain finally resolves to changes.
+type SymlinkChainRefresher struct {
+	RuntimePath string
+
+	mu      sync.Mutex
+	target  string
+	watcher PathWatcher
+	// watched are the directories the refresher added to watcher. Other
+	// paths in watcher, such as the git refs the loader watches, are left be.
+	watched map[string]bool
+	logger  Logger
+}
+
+// WatchDirectory implements Refresher, for use with loaders that only watch a
+// single directory. Prefer passing the refresher to New2, which watches the
+// whole chain.
+func (s *SymlinkChainRefresher) WatchDirectory(runtimePath string, appDirPath string) string {
+	return filepath.Dir(s.RuntimePath)
+}
+
+func (s *SymlinkChainRefresher) Watch(runtimePath string, appDirPath string, watcher PathWatcher) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.watcher = watcher
+	s.watched = map[string]bool{}
+	if err := watcher.Add(filepath.Dir(s.RuntimePath)); err != nil {
+		return err
+	}
+	s.watched[filepath.Dir(s.RuntimePath)] = true
+	s.resolveLocked()
+	return nil
+}
+
+func (s *SymlinkChainRefresher) ShouldRefresh(path string, op FileSystemOp) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.target
+	s.resolveLocked()
+	return s.target != previous
+}
+
+// WatchError does nothing; the loader logs watcher errors itself.
+func (s *SymlinkChainRefresher) WatchError(err error) {}
+
+// SetLogger implements LoggerSetter. Without it, the standard logrus logger
+// is used.
+func (s *SymlinkChainRefresher) SetLogger(logger Logger) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logger = logger
+}
+
+// resolveLocked re-resolves the chain and watches the directories it passes
+// through. While the chain is broken, for example mid-swap, the directories
+// already watched stay watched.
+func (s *SymlinkChainRefresher) resolveLocked() {
+	target, links, err := resolveSymlinkChain(s.RuntimePath)
+	if err != nil {
+		s.target = ""
+		return
+	}
+	s.target = target
+	if s.watcher == nil {
+		return
+	}
+
+	want := map[string]bool{filepath.Dir(s.RuntimePath): true}
+	for _, link := range links {
+		dir := filepath.Dir(link)
+		want[dir] = true
+		if err := s.watcher.Add(dir); err != nil {
+			s.log().Warn("runtime: error watching symlink directory", pathField(dir), errorField(err))
+			continue
+		}
+		s.watched[dir] = true
+	}
+	for dir := range s.watched {
+		if !want[dir] {
+			s.watcher.Remove(dir)
+			delete(s.watched, dir)
+		}
+	}
+}
+
+func (s *SymlinkChainRefresher) log() Logger {
+	if s.logger == nil {
+		return defaultLogger
+	}
+	return s.logger
+}
+
+// resolveSymlinkChain resolves path like filepath.EvalSymlinks, additionally
+// returning the absolute path of every symlink followed along the way.
+func resolveSymlinkChain(path string) (target string, links []string, err error) {
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return "", nil, err
+	}
+
+	resolved := string(filepath.Separator)
+	remaining := splitPath(path)
+	for hops := 0; len(remaining) > 0; {
+		name := remaining[0]
+		remaining = remaining[1:]
+
+		if name == ".." {
+			resolved = filepath.Dir(resolved)
+			continue
+		}
+
+		next := filepath.Join(resolved, name)
+		info, err := os.Lstat(next)
+		if err != nil {
+			return "", nil, err
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+
+		if hops++; hops > maxSymlinkHops {
+			return "", nil, errors.New("goruntime/loader: too many levels of symbolic links")
+		}
+		links = append(links, next)
+
+		dest, err := os.Readlink(next)
+		if err != nil {
+			return "", nil, err
+		}
+		// Relative targets are relative to the directory holding the link,
+		// which is already fully resolved.
+		if !filepath.IsAbs(dest) {
+			dest = filepath.Join(resolved, dest)
+		}
+		resolved = string(filepath.Separator)
+		remaining = append(splitPath(dest), remaining...)
+	}
+
+	return resolved, links, nil
+}
+
+func splitPath(path string) []string {
+	var parts []string
+	for _, part := range strings.Split(filepath.Clean(path), string(filepath.Separator)) {
+		if part != "" && part != "." {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
@@ -0,0 +1,56 @@
+package loader
+
+import (
+	"context"
+
+	"github.com/lyft/goruntime/snapshot"
+)
+
+// Viewer is implemented by loaders that call a function with their current
+// snapshot, such as *Loader and override.Loader. Use ViewOf to view any loader.
+type Viewer interface {
+	// Call fn with the current snapshot, so that related keys are read from the same runtime version.
+	// @param fn supplies the function to call.
+	View(fn func(s snapshot.IFace))
+}
+
+// ViewOf calls fn with the current snapshot of l, through its View method if it
+// implements Viewer. Every read fn makes from that snapshot sees the same
+// runtime version, even if a reload happens meanwhile.
+func ViewOf(l IFace, fn func(s snapshot.IFace)) {
+	if v, ok := l.(Viewer); ok {
+		v.View(fn)
+		return
+	}
+	fn(l.Snapshot())
+}
+
+// View calls fn with the current snapshot. Every read fn makes from that
+// snapshot sees the same runtime version, even if a reload happens meanwhile.
+func (l *Loader) View(fn func(s snapshot.IFace)) {
+	fn(l.Snapshot())
+}
+
+func (n Nil) View(fn func(s snapshot.IFace)) {
+	fn(n.Snapshot())
+}
+
+// Pin returns a copy of ctx carrying the current snapshot of l, so the code
+// handling a request reads one runtime version throughout. If ctx already
+// carries a snapshot of l it is returned unchanged. Snapshots of other loaders
+// pinned in ctx are kept alongside.
+func Pin(ctx context.Context, l IFace) context.Context {
+	if _, ok := snapshot.FromContext(ctx, l); ok {
+		return ctx
+	}
+	return snapshot.NewContext(ctx, l, l.Snapshot())
+}
+
+// SnapshotFromContext returns the snapshot of l pinned in ctx, or the current
+// snapshot of l if there is none.
+func SnapshotFromContext(ctx context.Context, l IFace) snapshot.IFace {
+	if s, ok := snapshot.FromContext(ctx, l); ok {
+		return s
+	}
+	return l.Snapshot()
+}
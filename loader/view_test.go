@@ -0,0 +1,58 @@
+package loader
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/lyft/goruntime/snapshot"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPin(t *testing.T) {
+	assert := require.New(t)
+
+	tempDir, err := ioutil.TempDir("", "view_test")
+	assert.NoError(err)
+	defer os.RemoveAll(tempDir)
+
+	makeFileInDir(assert, tempDir+"/app/key", "1")
+	loader, err := New2(tempDir, "app", nullScope, &manualRefresher{})
+	assert.NoError(err)
+	defer loader.(*Loader).Close()
+	l := loader.(*Loader)
+
+	ctx := Pin(context.Background(), l)
+	assert.Equal(ctx, Pin(ctx, l))
+
+	makeFileInDir(assert, tempDir+"/app/key", "2")
+	l.onRuntimeChanged()
+	assert.Equal(uint64(1), SnapshotFromContext(ctx, l).GetInteger("key", 0))
+	assert.Equal(uint64(2), SnapshotFromContext(context.Background(), l).GetInteger("key", 0))
+
+	l.View(func(s snapshot.IFace) {
+		assert.Equal(uint64(2), s.GetInteger("key", 0))
+	})
+}
+
+// plainLoader is a loader that does not implement Viewer.
+type plainLoader struct {
+	snapshot snapshot.IFace
+}
+
+func (p plainLoader) Snapshot() snapshot.IFace            { return p.snapshot }
+func (plainLoader) AddUpdateCallback(callback chan<- int) {}
+
+func TestViewOf(t *testing.T) {
+	assert := require.New(t)
+
+	s := snapshot.NewMock().Set("key", "1")
+	var viewed snapshot.IFace
+	ViewOf(plainLoader{s}, func(s snapshot.IFace) { viewed = s })
+	assert.Equal(s, viewed)
+
+	viewed = nil
+	ViewOf(NewNil(), func(s snapshot.IFace) { viewed = s })
+	assert.NotNil(viewed)
+}
@@ -0,0 +1,84 @@
+package override
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// UserHeader is the request header identifying who makes a change, unless the
+// request has a "user" form value.
+const UserHeader = "X-Runtime-User"
+
+type handler struct {
+	loader *Loader
+}
+
+// NewHandler returns an http.Handler managing the overrides of l:
+//
+//	GET                   lists the active overrides as JSON.
+//	POST key, value, ttl  sets an override for ttl, a Go duration such as "30m".
+//	                      An optional reason is logged with it.
+//	DELETE key            removes an override.
+//
+// Parameters are read from the query string or, for POST, a form body. POST and DELETE
+// requests must identify the user making the change, either in a "user"
+// parameter or in the X-Runtime-User header. The handler does no
+// authentication of its own and must only be exposed to trusted operators.
+func NewHandler(l *Loader) http.Handler {
+	return &handler{loader: l}
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, h.loader.Overrides())
+	case http.MethodPost:
+		user, ok := requestUser(w, r)
+		if !ok {
+			return
+		}
+		ttl, err := time.ParseDuration(r.FormValue("ttl"))
+		if err != nil {
+			http.Error(w, "invalid ttl: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		o, err := h.loader.Set(r.FormValue("key"), r.FormValue("value"), ttl, user, r.FormValue("reason"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, http.StatusCreated, o)
+	case http.MethodDelete:
+		user, ok := requestUser(w, r)
+		if !ok {
+			return
+		}
+		if !h.loader.Delete(r.FormValue("key"), user) {
+			http.Error(w, "no override of "+r.FormValue("key"), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func requestUser(w http.ResponseWriter, r *http.Request) (string, bool) {
+	user := r.FormValue("user")
+	if user == "" {
+		user = r.Header.Get(UserHeader)
+	}
+	if user == "" {
+		http.Error(w, "the user making the change is required", http.StatusBadRequest)
+		return "", false
+	}
+	return user, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
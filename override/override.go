@@ -0,0 +1,306 @@
+// Package override layers temporary, in-process runtime overrides on top of a
+// loader, for flipping a kill switch on a single host during an incident
+// without deploying runtime. Every override expires after a mandatory TTL and
+// every change is logged with who made it, but never with the value.
+package override
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lyft/goruntime/loader"
+	"github.com/lyft/goruntime/snapshot"
+	"github.com/lyft/goruntime/snapshot/entry"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ActiveMetadataKey is the snapshot metadata key listing the overridden keys,
+// comma separated. It is only set while overrides are active.
+const ActiveMetadataKey = "overrides.active"
+
+// DefaultMaxTTL is the longest TTL accepted unless changed with MaxTTL.
+const DefaultMaxTTL = 24 * time.Hour
+
+// Override is an active override of a runtime key.
+type Override struct {
+	Key       string    `json:"key"`
+	Value     string    `json:"value"`
+	SetBy     string    `json:"set_by"`
+	Reason    string    `json:"reason,omitempty"`
+	SetAt     time.Time `json:"set_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type override struct {
+	Override
+	timer *time.Timer
+}
+
+// merged is a base snapshot with the active overrides applied, or an empty
+// merged while there are no overrides.
+type merged struct {
+	base     snapshot.IFace
+	snapshot snapshot.IFace
+}
+
+// seenBase is the last snapshot of a base loader without a Generation method,
+// and the number of different snapshots seen so far.
+type seenBase struct {
+	snapshot   snapshot.IFace
+	generation uint64
+}
+
+type generational interface {
+	Generation() uint64
+}
+
+// Loader is a loader.IFace serving the snapshots of a base loader with the
+// active overrides applied.
+type Loader struct {
+	// version is incremented whenever the overrides change. It is accessed
+	// atomically and kept first for 64-bit alignment.
+	version uint64
+	base    loader.IFace
+	maxTTL  time.Duration
+	logger  loader.Logger
+
+	// merged holds a *merged, replaced when the overrides change and when a
+	// read finds that the base loader published a new snapshot. seen holds a
+	// *seenBase. Both are only stored with mu held.
+	merged atomic.Value
+	seen   atomic.Value
+
+	mu        sync.Mutex
+	overrides map[string]*override
+	callbacks []chan struct{}
+}
+
+type Option func(l *Loader)
+
+// MaxTTL sets the longest TTL an override may be set for.
+func MaxTTL(ttl time.Duration) Option {
+	return func(l *Loader) { l.maxTTL = ttl }
+}
+
+// WithLogger sends the audit trail of override changes to logger instead of
+// the standard logrus logger. Changes are logged as warnings, so they are kept
+// at the usual production log levels.
+func WithLogger(logger loader.Logger) Option {
+	return func(l *Loader) { l.logger = logger }
+}
+
+func New(base loader.IFace, opts ...Option) *Loader {
+	l := &Loader{
+		base:      base,
+		maxTTL:    DefaultMaxTTL,
+		logger:    loader.NewLogrusLogger(logrus.StandardLogger()),
+		overrides: map[string]*override{},
+	}
+	l.merged.Store(&merged{})
+	l.seen.Store(&seenBase{})
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// Snapshot returns the base loader's current snapshot with the active
+// overrides applied. Without overrides the base snapshot is returned as is.
+// Reads only take a lock when the base loader published a new snapshot since
+// the overrides were last applied.
+func (l *Loader) Snapshot() snapshot.IFace {
+	base := l.base.Snapshot()
+	m := l.merged.Load().(*merged)
+	if m.snapshot == nil {
+		return base
+	}
+	if m.base == base {
+		return m.snapshot
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.mergeLocked()
+}
+
+// Generation changes whenever Snapshot does: it is the number of changes to
+// the overrides plus the generation of the base loader. Base loaders without
+// a Generation method are given one counting the different snapshots seen.
+func (l *Loader) Generation() uint64 {
+	return atomic.LoadUint64(&l.version) + l.baseGeneration()
+}
+
+func (l *Loader) baseGeneration() uint64 {
+	if g, ok := l.base.(generational); ok {
+		return g.Generation()
+	}
+
+	base := l.base.Snapshot()
+	if seen := l.seen.Load().(*seenBase); seen.snapshot == base {
+		return seen.generation
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	seen := l.seen.Load().(*seenBase)
+	if seen.snapshot != base {
+		seen = &seenBase{snapshot: base, generation: seen.generation + 1}
+		l.seen.Store(seen)
+	}
+	return seen.generation
+}
+
+// mergeLocked applies the active overrides to the base loader's current
+// snapshot, stores the result as the merged snapshot and returns it.
+func (l *Loader) mergeLocked() snapshot.IFace {
+	base := l.base.Snapshot()
+	if len(l.overrides) == 0 {
+		l.merged.Store(&merged{})
+		return base
+	}
+
+	s := snapshot.New()
+	for key, e := range base.Entries() {
+		s.SetEntry(key, e)
+	}
+	for key, value := range snapshot.Metadata(base) {
+		s.SetMetadata(key, value)
+	}
+
+	keys := make([]string, 0, len(l.overrides))
+	for key, o := range l.overrides {
+		s.SetEntry(key, entry.New(o.Value, o.SetAt))
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	s.SetMetadata(ActiveMetadataKey, strings.Join(keys, ","))
+	l.merged.Store(&merged{base: base, snapshot: s})
+	return s
+}
+
+// AddUpdateCallback adds a channel that is written to when the base loader
+// publishes a new snapshot or the overrides change.
+func (l *Loader) AddUpdateCallback(callback chan<- int) {
+	l.base.AddUpdateCallback(callback)
+
+	// Like the loader, signal through a buffered channel so that a blocked
+	// callback never blocks setting an override.
+	notify := make(chan struct{}, 1)
+	l.mu.Lock()
+	l.callbacks = append(l.callbacks, notify)
+	l.mu.Unlock()
+	go func() {
+		for range notify {
+			callback <- 1
+		}
+	}()
+}
+
+func (l *Loader) View(fn func(s snapshot.IFace)) {
+	fn(l.Snapshot())
+}
+
+// changedLocked applies the changed overrides and signals the callbacks.
+func (l *Loader) changedLocked() {
+	l.mergeLocked()
+	atomic.AddUint64(&l.version, 1)
+	for _, notify := range l.callbacks {
+		select {
+		case notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Set overrides key with value for ttl, replacing any existing override of
+// key. setBy identifies who set the override and is required.
+func (l *Loader) Set(key string, value string, ttl time.Duration, setBy string, reason string) (Override, error) {
+	switch {
+	case key == "":
+		return Override{}, errors.New("goruntime/override: key is required")
+	case setBy == "":
+		return Override{}, errors.New("goruntime/override: setBy is required")
+	case ttl <= 0:
+		return Override{}, errors.New("goruntime/override: ttl must be positive")
+	case ttl > l.maxTTL:
+		return Override{}, fmt.Errorf("goruntime/override: ttl %s is longer than the maximum of %s", ttl, l.maxTTL)
+	}
+
+	now := time.Now()
+	o := &override{Override: Override{
+		Key:       key,
+		Value:     value,
+		SetBy:     setBy,
+		Reason:    reason,
+		SetAt:     now,
+		ExpiresAt: now.Add(ttl),
+	}}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if previous, ok := l.overrides[key]; ok {
+		previous.timer.Stop()
+	}
+	l.overrides[key] = o
+	o.timer = time.AfterFunc(ttl, func() { l.expire(o) })
+	l.changedLocked()
+
+	l.logger.Warn("runtime: override set", keyField(key), setByField(setBy),
+		loader.Field{Key: "ttl", Value: ttl.String()}, loader.Field{Key: "reason", Value: reason})
+	return o.Override, nil
+}
+
+// Delete removes the override of key, reporting whether there was one.
+// deletedBy identifies who removed it.
+func (l *Loader) Delete(key string, deletedBy string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	o, ok := l.overrides[key]
+	if !ok {
+		return false
+	}
+	o.timer.Stop()
+	delete(l.overrides, key)
+	l.changedLocked()
+
+	l.logger.Warn("runtime: override deleted", keyField(key), setByField(o.SetBy),
+		loader.Field{Key: "deleted_by", Value: deletedBy})
+	return true
+}
+
+func (l *Loader) expire(o *override) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// The override may have been replaced or deleted since the timer fired.
+	if l.overrides[o.Key] != o {
+		return
+	}
+	delete(l.overrides, o.Key)
+	l.changedLocked()
+
+	l.logger.Warn("runtime: override expired", keyField(o.Key), setByField(o.SetBy))
+}
+
+func keyField(key string) loader.Field     { return loader.Field{Key: loader.FieldKey, Value: key} }
+func setByField(setBy string) loader.Field { return loader.Field{Key: "set_by", Value: setBy} }
+
+// Overrides returns the active overrides, sorted by key.
+func (l *Loader) Overrides() []Override {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	overrides := make([]Override, 0, len(l.overrides))
+	for _, o := range l.overrides {
+		overrides = append(overrides, o.Override)
+	}
+	sort.Slice(overrides, func(i, j int) bool { return overrides[i].Key < overrides[j].Key })
+	return overrides
+}
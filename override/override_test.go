@@ -0,0 +1,238 @@
+package override_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lyft/goruntime/loader"
+	"github.com/lyft/goruntime/override"
+	"github.com/lyft/goruntime/snapshot"
+	"github.com/stretchr/testify/require"
+)
+
+type staticLoader struct {
+	snapshot snapshot.IFace
+}
+
+func (s staticLoader) Snapshot() snapshot.IFace            { return s.snapshot }
+func (staticLoader) AddUpdateCallback(callback chan<- int) {}
+
+func newBase() staticLoader {
+	s := snapshot.NewMock().Set("feature.kill", "0").Set("name", "base")
+	s.SetMetadata("git.commit", "abc")
+	return staticLoader{s}
+}
+
+func TestOverride(t *testing.T) {
+	assert := require.New(t)
+
+	base := newBase()
+	l := override.New(base)
+	assert.Equal(base.snapshot, l.Snapshot())
+
+	update := make(chan int, 1)
+	l.AddUpdateCallback(update)
+
+	o, err := l.Set("feature.kill", "100", time.Hour, "alice", "incident 42")
+	assert.NoError(err)
+	assert.Equal("alice", o.SetBy)
+	assert.WithinDuration(time.Now().Add(time.Hour), o.ExpiresAt, time.Second)
+	select {
+	case <-update:
+	case <-time.After(time.Second):
+		t.Fatal("no update after setting an override")
+	}
+
+	s := l.Snapshot()
+	assert.Equal(uint64(100), s.GetInteger("feature.kill", 0))
+	assert.Equal("base", s.Get("name"))
+	assert.Equal("abc", snapshot.Metadata(s)["git.commit"])
+	assert.Equal("feature.kill", snapshot.Metadata(s)[override.ActiveMetadataKey])
+	assert.Equal(s, l.Snapshot())
+	assert.Empty(snapshot.Metadata(base.snapshot)[override.ActiveMetadataKey])
+
+	_, err = l.Set("new.key", "1", time.Hour, "bob", "")
+	assert.NoError(err)
+	assert.Equal("feature.kill,new.key", snapshot.Metadata(l.Snapshot())[override.ActiveMetadataKey])
+	assert.Len(l.Overrides(), 2)
+
+	assert.True(l.Delete("new.key", "alice"))
+	assert.False(l.Delete("new.key", "alice"))
+	assert.Equal("", l.Snapshot().Get("new.key"))
+}
+
+func TestOverrideExpires(t *testing.T) {
+	assert := require.New(t)
+
+	l := override.New(newBase())
+	_, err := l.Set("feature.kill", "100", 10*time.Millisecond, "alice", "")
+	assert.NoError(err)
+	assert.Equal(uint64(100), l.Snapshot().GetInteger("feature.kill", 0))
+
+	assert.Eventually(func() bool { return len(l.Overrides()) == 0 }, time.Second, time.Millisecond)
+	assert.Equal("0", l.Snapshot().Get("feature.kill"))
+	assert.NotContains(snapshot.Metadata(l.Snapshot()), override.ActiveMetadataKey)
+
+	// Replacing an override restarts its TTL.
+	_, err = l.Set("name", "first", 10*time.Millisecond, "alice", "")
+	assert.NoError(err)
+	_, err = l.Set("name", "second", time.Hour, "alice", "")
+	assert.NoError(err)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal("second", l.Snapshot().Get("name"))
+}
+
+// mutableBase is a base loader whose snapshot can be replaced. It has no
+// Generation method.
+type mutableBase struct {
+	mu       sync.Mutex
+	snapshot snapshot.IFace
+}
+
+func (b *mutableBase) Snapshot() snapshot.IFace {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.snapshot
+}
+
+func (*mutableBase) AddUpdateCallback(callback chan<- int) {}
+
+func (b *mutableBase) set(s snapshot.IFace) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.snapshot = s
+}
+
+func TestOverrideGeneration(t *testing.T) {
+	assert := require.New(t)
+
+	base := &mutableBase{snapshot: snapshot.NewMock().Set("name", "base")}
+	l := override.New(base)
+	generation := l.Generation()
+	assert.Equal(generation, l.Generation())
+
+	_, err := l.Set("name", "overridden", time.Hour, "alice", "")
+	assert.NoError(err)
+	assert.True(l.Generation() > generation)
+	generation = l.Generation()
+	assert.Equal("overridden", l.Snapshot().Get("name"))
+
+	// A new base snapshot is merged with the overrides when it is read.
+	base.set(snapshot.NewMock().Set("name", "base2").Set("other", "1"))
+	assert.True(l.Generation() > generation)
+	generation = l.Generation()
+	assert.Equal("1", l.Snapshot().Get("other"))
+	assert.Equal("overridden", l.Snapshot().Get("name"))
+	assert.Equal(generation, l.Generation())
+
+	assert.True(l.Delete("name", "bob"))
+	assert.True(l.Generation() > generation)
+	assert.Equal("base2", l.Snapshot().Get("name"))
+}
+
+// recordingLogger records warnings as the message followed by its fields.
+type recordingLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (r *recordingLogger) Debug(msg string, fields ...loader.Field) {}
+func (r *recordingLogger) Info(msg string, fields ...loader.Field)  {}
+func (r *recordingLogger) Error(msg string, fields ...loader.Field) {}
+
+func (r *recordingLogger) Warn(msg string, fields ...loader.Field) {
+	line := msg
+	for _, f := range fields {
+		line += " " + f.Key + "=" + f.Value.(string)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lines = append(r.lines, line)
+}
+
+func (r *recordingLogger) recorded() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.lines...)
+}
+
+func TestOverrideAuditLog(t *testing.T) {
+	assert := require.New(t)
+
+	log := &recordingLogger{}
+	l := override.New(newBase(), override.WithLogger(log))
+	_, err := l.Set("db.password", "hunter2", time.Hour, "alice", "rotation")
+	assert.NoError(err)
+	assert.True(l.Delete("db.password", "bob"))
+	_, err = l.Set("feature.kill", "100", time.Millisecond, "alice", "")
+	assert.NoError(err)
+	assert.Eventually(func() bool { return len(l.Overrides()) == 0 }, time.Second, time.Millisecond)
+
+	// Values, which may be secrets, are never logged.
+	assert.Equal([]string{
+		"runtime: override set key=db.password set_by=alice ttl=1h0m0s reason=rotation",
+		"runtime: override deleted key=db.password set_by=alice deleted_by=bob",
+		"runtime: override set key=feature.kill set_by=alice ttl=1ms reason=",
+		"runtime: override expired key=feature.kill set_by=alice",
+	}, log.recorded())
+}
+
+func TestOverrideValidation(t *testing.T) {
+	assert := require.New(t)
+
+	l := override.New(newBase(), override.MaxTTL(time.Hour))
+	_, err := l.Set("", "1", time.Minute, "alice", "")
+	assert.Error(err)
+	_, err = l.Set("key", "1", time.Minute, "", "")
+	assert.Error(err)
+	_, err = l.Set("key", "1", 0, "alice", "")
+	assert.Error(err)
+	_, err = l.Set("key", "1", 2*time.Hour, "alice", "")
+	assert.Error(err)
+	assert.Empty(l.Overrides())
+}
+
+func TestHandler(t *testing.T) {
+	assert := require.New(t)
+
+	l := override.New(newBase())
+	h := override.NewHandler(l)
+
+	do := func(method string, form url.Values, user string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/?"+form.Encode(), nil)
+		if method == "POST" {
+			req = httptest.NewRequest(method, "/", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		if user != "" {
+			req.Header.Set(override.UserHeader, user)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	set := url.Values{"key": {"feature.kill"}, "value": {"100"}, "ttl": {"30m"}, "reason": {"incident"}}
+	assert.Equal(http.StatusBadRequest, do("POST", set, "").Code)
+	assert.Equal(http.StatusBadRequest, do("POST", url.Values{"key": {"k"}, "ttl": {"soon"}}, "alice").Code)
+
+	w := do("POST", set, "alice")
+	assert.Equal(http.StatusCreated, w.Code)
+	assert.Contains(w.Body.String(), `"set_by":"alice"`)
+	assert.Equal(uint64(100), l.Snapshot().GetInteger("feature.kill", 0))
+
+	w = do("GET", nil, "")
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Body.String(), `"key":"feature.kill"`)
+
+	assert.Equal(http.StatusNotFound, do("DELETE", url.Values{"key": {"other"}}, "bob").Code)
+	assert.Equal(http.StatusNoContent, do("DELETE", url.Values{"key": {"feature.kill"}, "user": {"bob"}}, "").Code)
+	assert.Empty(l.Overrides())
+
+	assert.Equal(http.StatusMethodNotAllowed, do("PUT", nil, "alice").Code)
+}
@@ -0,0 +1,353 @@
+package runtime
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/lyft/goruntime/loader"
+	"github.com/lyft/goruntime/schema"
+	"github.com/lyft/goruntime/snapshot"
+)
+
+// Kind is the type of a declared runtime key.
+type Kind string
+
+const (
+	KindInt     Kind = "int"
+	KindString  Kind = "string"
+	KindBool    Kind = "bool"
+	KindFeature Kind = "feature"
+)
+
+// Definition describes a declared runtime key.
+type Definition struct {
+	Key  string
+	Kind Kind
+	// Default is the value used when the key is missing or invalid, formatted
+	// as it would appear in a runtime file.
+	Default     string
+	Description string
+}
+
+type definition struct {
+	Definition
+	handle interface{}
+}
+
+// Registry holds declared runtime keys and the loader they are read from.
+// Handles read from an empty snapshot, and so return their defaults, until a
+// loader is bound.
+type Registry struct {
+	mu          sync.Mutex
+	definitions map[string]*definition
+
+	binding unsafe.Pointer // *binding
+}
+
+// binding is a loader bound to a registry.
+type binding struct {
+	loader loader.IFace
+	// generation is the loader if it has a Generation method, or nil, in which
+	// case handles cannot cache their values.
+	generation generational
+}
+
+type generational interface {
+	Generation() uint64
+}
+
+var emptySnapshot = snapshot.New()
+
+var unbound = &binding{generation: loader.NewNil()}
+
+func (b *binding) snapshot() snapshot.IFace {
+	if b.loader == nil {
+		return emptySnapshot
+	}
+	return b.loader.Snapshot()
+}
+
+func NewRegistry() *Registry {
+	return &Registry{definitions: map[string]*definition{}}
+}
+
+// DefaultRegistry is the registry used by the package level functions.
+var DefaultRegistry = NewRegistry()
+
+// Bind makes the handles of r read from l. It may be called again to switch
+// loaders. Handles cache their values between snapshots if l has a
+// Generation method, as *loader.Loader does.
+func (r *Registry) Bind(l loader.IFace) {
+	b := unbound
+	if l != nil {
+		b = &binding{loader: l}
+		if g, ok := l.(generational); ok {
+			b.generation = g
+		}
+	}
+	atomic.StorePointer(&r.binding, unsafe.Pointer(b))
+}
+
+func (r *Registry) bound() *binding {
+	if b := (*binding)(atomic.LoadPointer(&r.binding)); b != nil {
+		return b
+	}
+	return unbound
+}
+
+// Snapshot returns the current snapshot of the bound loader.
+func (r *Registry) Snapshot() snapshot.IFace {
+	return r.bound().snapshot()
+}
+
+// valueCache holds the value of a handle for one snapshot generation, so
+// reads only look at the snapshot after it changes.
+type valueCache struct {
+	v unsafe.Pointer // *cachedValue
+}
+
+type cachedValue struct {
+	binding    *binding
+	generation uint64
+	value      interface{}
+}
+
+// resolver computes the value of a handle from a snapshot.
+type resolver interface {
+	resolve(s snapshot.IFace) interface{}
+}
+
+// get returns the value of h, only resolving it if the bound loader or its
+// generation changed since it was cached. A read of an unchanged value takes
+// a few atomic loads and writes nothing shared, so it scales with the number
+// of readers.
+func (c *valueCache) get(r *Registry, h resolver) interface{} {
+	b := r.bound()
+	// Values are only cached for bindings with a generation.
+	if cached := (*cachedValue)(atomic.LoadPointer(&c.v)); cached != nil && cached.binding == b && cached.generation == b.generation.Generation() {
+		return cached.value
+	}
+	return c.resolve(b, h)
+}
+
+// resolve is the slow path of get, kept separate so get stays small.
+func (c *valueCache) resolve(b *binding, h resolver) interface{} {
+	if b.generation == nil {
+		return h.resolve(b.snapshot())
+	}
+
+	// The generation is read before the snapshot, so if a new snapshot is
+	// published in between the value is cached under the older generation and
+	// resolved again on the next read.
+	generation := b.generation.Generation()
+	value := h.resolve(b.snapshot())
+	atomic.StorePointer(&c.v, unsafe.Pointer(&cachedValue{binding: b, generation: generation, value: value}))
+	return value
+}
+
+// Definitions returns every declared key, sorted by key.
+func (r *Registry) Definitions() []Definition {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	definitions := make([]Definition, 0, len(r.definitions))
+	for _, d := range r.definitions {
+		definitions = append(definitions, d.Definition)
+	}
+	sort.Slice(definitions, func(i, j int) bool { return definitions[i].Key < definitions[j].Key })
+	return definitions
+}
+
+// Schema returns a schema holding a rule for every declared key, so snapshots
+// can be validated against the types and defaults declared in code.
+func (r *Registry) Schema() *schema.Schema {
+	s := schema.New()
+	for _, d := range r.Definitions() {
+		rule := schema.Rule{Default: d.Default, Description: d.Description}
+		switch d.Kind {
+		case KindInt:
+			rule.Type = schema.Integer
+		case KindBool:
+			rule.Type = schema.Boolean
+		case KindFeature:
+			rule.Type = schema.Integer
+			rule.Max = schema.Bound(100)
+		}
+		s.MustKey(d.Key, rule)
+	}
+	return s
+}
+
+// declare registers key, returning the handle of an identical earlier
+// declaration if there is one. It panics if key was declared with a different
+// kind or default.
+func (r *Registry) declare(d Definition, newHandle func() interface{}) interface{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if existing, ok := r.definitions[d.Key]; ok {
+		if existing.Kind != d.Kind || existing.Default != d.Default {
+			panic(fmt.Sprintf("goruntime: runtime key %s declared as %s with default %q and as %s with default %q",
+				d.Key, existing.Kind, existing.Default, d.Kind, d.Default))
+		}
+		if existing.Description == "" {
+			existing.Description = d.Description
+		}
+		return existing.handle
+	}
+
+	handle := newHandle()
+	r.definitions[d.Key] = &definition{Definition: d, handle: handle}
+	return handle
+}
+
+// IntHandle reads an integer runtime key.
+type IntHandle struct {
+	registry     *Registry
+	key          string
+	defaultValue uint64
+	cache        valueCache
+}
+
+// Int declares an integer runtime key. The returned handle caches its value
+// for each snapshot, so Get is cheap enough for hot paths.
+func (r *Registry) Int(key string, defaultValue uint64, description string) *IntHandle {
+	d := Definition{Key: key, Kind: KindInt, Default: strconv.FormatUint(defaultValue, 10), Description: description}
+	return r.declare(d, func() interface{} {
+		return &IntHandle{registry: r, key: key, defaultValue: defaultValue}
+	}).(*IntHandle)
+}
+
+func (h *IntHandle) Key() string { return h.key }
+
+// Get returns the current value, or the default if the key is missing or not an integer.
+func (h *IntHandle) Get() uint64 {
+	return h.cache.get(h.registry, h).(uint64)
+}
+
+func (h *IntHandle) resolve(s snapshot.IFace) interface{} {
+	return s.GetInteger(h.key, h.defaultValue)
+}
+
+// StringHandle reads a string runtime key.
+type StringHandle struct {
+	registry     *Registry
+	key          string
+	defaultValue string
+	cache        valueCache
+}
+
+// String declares a string runtime key.
+func (r *Registry) String(key string, defaultValue string, description string) *StringHandle {
+	d := Definition{Key: key, Kind: KindString, Default: defaultValue, Description: description}
+	return r.declare(d, func() interface{} {
+		return &StringHandle{registry: r, key: key, defaultValue: defaultValue}
+	}).(*StringHandle)
+}
+
+func (h *StringHandle) Key() string { return h.key }
+
+// Get returns the current value, or the default if the key is missing.
+func (h *StringHandle) Get() string {
+	return h.cache.get(h.registry, h).(string)
+}
+
+func (h *StringHandle) resolve(s snapshot.IFace) interface{} {
+	if e, ok := s.Entries()[h.key]; ok {
+		return e.StringValue
+	}
+	return h.defaultValue
+}
+
+// BoolHandle reads a boolean runtime key.
+type BoolHandle struct {
+	registry     *Registry
+	key          string
+	defaultValue bool
+	cache        valueCache
+}
+
+// Bool declares a boolean runtime key. Values are parsed with strconv.ParseBool.
+func (r *Registry) Bool(key string, defaultValue bool, description string) *BoolHandle {
+	d := Definition{Key: key, Kind: KindBool, Default: strconv.FormatBool(defaultValue), Description: description}
+	return r.declare(d, func() interface{} {
+		return &BoolHandle{registry: r, key: key, defaultValue: defaultValue}
+	}).(*BoolHandle)
+}
+
+func (h *BoolHandle) Key() string { return h.key }
+
+// Get returns the current value, or the default if the key is missing or not a boolean.
+func (h *BoolHandle) Get() bool {
+	return h.cache.get(h.registry, h).(bool)
+}
+
+func (h *BoolHandle) resolve(s snapshot.IFace) interface{} {
+	if e, ok := s.Entries()[h.key]; ok {
+		if v, err := strconv.ParseBool(strings.TrimSpace(e.StringValue)); err == nil {
+			return v
+		}
+	}
+	return h.defaultValue
+}
+
+// FeatureHandle reads a feature percentage runtime key. Unlike the other
+// handles it reads the snapshot on every call.
+type FeatureHandle struct {
+	registry          *Registry
+	key               string
+	defaultPercentage uint64
+}
+
+// Feature declares a runtime key holding the percentage, 0-100, of calls or
+// IDs a feature is enabled for.
+func (r *Registry) Feature(key string, defaultPercentage uint64, description string) *FeatureHandle {
+	d := Definition{Key: key, Kind: KindFeature, Default: strconv.FormatUint(defaultPercentage, 10), Description: description}
+	return r.declare(d, func() interface{} {
+		return &FeatureHandle{registry: r, key: key, defaultPercentage: defaultPercentage}
+	}).(*FeatureHandle)
+}
+
+func (h *FeatureHandle) Key() string { return h.key }
+
+// Enabled rolls the dice like snapshot.IFace.FeatureEnabled.
+func (h *FeatureHandle) Enabled() bool {
+	return h.registry.Snapshot().FeatureEnabled(h.key, h.defaultPercentage)
+}
+
+// EnabledForID reports whether the feature is enabled for id, consistently
+// across calls, like snapshot.IFace.FeatureEnabledForID.
+func (h *FeatureHandle) EnabledForID(id uint64) bool {
+	return h.registry.Snapshot().FeatureEnabledForID(h.key, id, uint32(h.defaultPercentage))
+}
+
+// Bind makes the handles of DefaultRegistry read from l.
+func Bind(l loader.IFace) { DefaultRegistry.Bind(l) }
+
+// Definitions returns every key declared in DefaultRegistry, sorted by key.
+func Definitions() []Definition { return DefaultRegistry.Definitions() }
+
+// Int declares an integer runtime key in DefaultRegistry.
+func Int(key string, defaultValue uint64, description string) *IntHandle {
+	return DefaultRegistry.Int(key, defaultValue, description)
+}
+
+// String declares a string runtime key in DefaultRegistry.
+func String(key string, defaultValue string, description string) *StringHandle {
+	return DefaultRegistry.String(key, defaultValue, description)
+}
+
+// Bool declares a boolean runtime key in DefaultRegistry.
+func Bool(key string, defaultValue bool, description string) *BoolHandle {
+	return DefaultRegistry.Bool(key, defaultValue, description)
+}
+
+// Feature declares a feature percentage runtime key in DefaultRegistry.
+func Feature(key string, defaultPercentage uint64, description string) *FeatureHandle {
+	return DefaultRegistry.Feature(key, defaultPercentage, description)
+}
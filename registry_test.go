@@ -0,0 +1,233 @@
+package runtime
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lyft/goruntime/loader"
+	"github.com/lyft/goruntime/schema"
+	"github.com/lyft/goruntime/snapshot"
+	"github.com/lyft/goruntime/snapshot/entry"
+	stats "github.com/lyft/gostats"
+	"github.com/stretchr/testify/require"
+)
+
+type staticLoader struct {
+	snapshot snapshot.IFace
+}
+
+func (s staticLoader) Snapshot() snapshot.IFace            { return s.snapshot }
+func (staticLoader) AddUpdateCallback(callback chan<- int) {}
+
+func snapshotOf(values map[string]string) snapshot.IFace {
+	s := snapshot.New()
+	for key, value := range values {
+		s.SetEntry(key, entry.New(value, time.Time{}))
+	}
+	return s
+}
+
+func TestRegistry(t *testing.T) {
+	assert := require.New(t)
+
+	r := NewRegistry()
+	timeout := r.Int("svc.timeout_ms", 250, "Upstream request timeout.")
+	name := r.String("svc.name", "default", "")
+	verbose := r.Bool("svc.verbose", true, "Log every request.")
+	feature := r.Feature("svc.new_path", 100, "Requests taking the new path.")
+
+	// Unbound handles return their defaults.
+	assert.Equal(uint64(250), timeout.Get())
+	assert.Equal("default", name.Get())
+	assert.True(verbose.Get())
+	assert.True(feature.Enabled())
+	assert.True(feature.EnabledForID(42))
+
+	r.Bind(staticLoader{snapshotOf(map[string]string{
+		"svc.timeout_ms": "100",
+		"svc.name":       "",
+		"svc.verbose":    "false\n",
+		"svc.new_path":   "0",
+	})})
+	assert.Equal(uint64(100), timeout.Get())
+	assert.Equal("", name.Get())
+	assert.False(verbose.Get())
+	assert.False(feature.Enabled())
+	assert.False(feature.EnabledForID(42))
+
+	r.Bind(staticLoader{snapshotOf(map[string]string{"svc.timeout_ms": "soon", "svc.verbose": "maybe"})})
+	assert.Equal(uint64(250), timeout.Get())
+	assert.True(verbose.Get())
+}
+
+func TestRegistryRedefinition(t *testing.T) {
+	assert := require.New(t)
+
+	r := NewRegistry()
+	timeout := r.Int("svc.timeout_ms", 250, "")
+	assert.Equal(timeout, r.Int("svc.timeout_ms", 250, "Upstream request timeout."))
+	assert.Equal("Upstream request timeout.", r.Definitions()[0].Description)
+
+	assert.Panics(func() { r.Int("svc.timeout_ms", 500, "") })
+	assert.Panics(func() { r.String("svc.timeout_ms", "250", "") })
+}
+
+func TestRegistryDefinitions(t *testing.T) {
+	assert := require.New(t)
+
+	r := NewRegistry()
+	r.Feature("b", 5, "B.")
+	r.Int("a", 1, "A.")
+	assert.Equal([]Definition{
+		{Key: "a", Kind: KindInt, Default: "1", Description: "A."},
+		{Key: "b", Kind: KindFeature, Default: "5", Description: "B."},
+	}, r.Definitions())
+
+	s := r.Schema()
+	assert.Nil(s.Validate("a", "10"))
+	assert.NotNil(s.Validate("a", "ten"))
+	assert.NotNil(s.Validate("b", "101"))
+	rule, _ := s.Lookup("b")
+	assert.Equal(schema.Integer, rule.Type)
+	assert.Equal("5", rule.Default)
+}
+
+// staticSource is a loader.Source serving values that only change when the
+// test calls set.
+type staticSource struct {
+	mu      sync.Mutex
+	values  map[string]string
+	changed func()
+}
+
+func (s *staticSource) Keys() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.values))
+	for key := range s.values {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (s *staticSource) Get(key string) (*entry.Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return entry.New(s.values[key], time.Time{}), nil
+}
+
+func (s *staticSource) Watch(stop <-chan struct{}, changed func()) error {
+	s.mu.Lock()
+	s.changed = changed
+	s.mu.Unlock()
+	<-stop
+	return nil
+}
+
+// set replaces the values and reloads the loader watching s.
+func (s *staticSource) set(t *testing.T, values map[string]string) {
+	s.mu.Lock()
+	s.values = values
+	changed := s.changed
+	s.mu.Unlock()
+	require.NotNil(t, changed, "source is not being watched")
+	changed()
+}
+
+func newStaticLoader(t testing.TB, values map[string]string) (loader.IFace, *staticSource) {
+	source := &staticSource{values: values}
+	l, err := loader.NewFromSource(source, stats.NewStore(stats.NewNullSink(), false))
+	require.NoError(t, err)
+	t.Cleanup(func() { l.(*loader.Loader).Close() })
+	require.Eventually(t, func() bool {
+		source.mu.Lock()
+		defer source.mu.Unlock()
+		return source.changed != nil
+	}, time.Second, time.Millisecond)
+	return l, source
+}
+
+func TestHandleCache(t *testing.T) {
+	assert := require.New(t)
+
+	l, source := newStaticLoader(t, map[string]string{"a": "1", "b": "x", "c": "true"})
+	r := NewRegistry()
+	a := r.Int("a", 0, "")
+	b := r.String("b", "", "")
+	c := r.Bool("c", false, "")
+	r.Bind(l)
+
+	assert.Equal(uint64(1), a.Get())
+	assert.Equal("x", b.Get())
+	assert.True(c.Get())
+
+	source.set(t, map[string]string{"a": "2", "b": "y"})
+	assert.Equal(uint64(2), a.Get())
+	assert.Equal("y", b.Get())
+	assert.False(c.Get())
+
+	// Rebinding invalidates cached values even if the generations match.
+	other, _ := newStaticLoader(t, map[string]string{"a": "3"})
+	r.Bind(other)
+	assert.Equal(uint64(3), a.Get())
+	r.Bind(nil)
+	assert.Equal(uint64(0), a.Get())
+
+	r.Bind(l)
+	allocs := testing.AllocsPerRun(100, func() { a.Get() })
+	assert.Equal(float64(0), allocs)
+}
+
+func BenchmarkVariable(b *testing.B) {
+	var v uint64 = 250
+	b.RunParallel(func(pb *testing.PB) {
+		var sum uint64
+		for pb.Next() {
+			sum += atomic.LoadUint64(&v)
+		}
+		_ = sum
+	})
+}
+
+func BenchmarkSnapshotGetInteger(b *testing.B) {
+	l, _ := newStaticLoader(b, map[string]string{"svc.timeout_ms": "250"})
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var sum uint64
+		for pb.Next() {
+			sum += l.Snapshot().GetInteger("svc.timeout_ms", 100)
+		}
+		_ = sum
+	})
+}
+
+func BenchmarkIntHandle(b *testing.B) {
+	l, _ := newStaticLoader(b, map[string]string{"svc.timeout_ms": "250"})
+	r := NewRegistry()
+	timeout := r.Int("svc.timeout_ms", 100, "")
+	r.Bind(l)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var sum uint64
+		for pb.Next() {
+			sum += timeout.Get()
+		}
+		_ = sum
+	})
+}
+
+func BenchmarkIntHandleUncached(b *testing.B) {
+	r := NewRegistry()
+	timeout := r.Int("svc.timeout_ms", 100, "")
+	r.Bind(staticLoader{snapshotOf(map[string]string{"svc.timeout_ms": "250"})})
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var sum uint64
+		for pb.Next() {
+			sum += timeout.Get()
+		}
+		_ = sum
+	})
+}
@@ -1 +1,10 @@
+// Package runtime declares the runtime keys a service reads, with their
+// defaults and descriptions, in one place. Keys are declared once, usually as
+// package variables, and read through typed handles:
+//
+//	var timeout = runtime.Int("svc.timeout_ms", 250, "Upstream request timeout.")
+//
+//	func init() { runtime.Bind(loader) }
+//
+//	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeout.Get())*time.Millisecond)
 package runtime
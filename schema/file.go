@@ -0,0 +1,97 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// File is the JSON form of a schema, mapping keys and key prefixes to rules:
+//
+//	{
+//	  "keys": {
+//	    "svc.timeout_ms": {"type": "integer", "min": 10, "max": 1000, "required": true}
+//	  },
+//	  "prefixes": {
+//	    "features.": {"type": "integer", "max": 100, "on_invalid": "keep_previous"}
+//	  }
+//	}
+type File struct {
+	Keys     map[string]Rule `json:"keys,omitempty"`
+	Prefixes map[string]Rule `json:"prefixes,omitempty"`
+}
+
+// Parse reads a schema in the File format. Unknown fields are an error, so
+// misspelled constraints are not silently ignored.
+func Parse(r io.Reader) (*Schema, error) {
+	var f File
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("goruntime/schema: %s", err)
+	}
+
+	s := New()
+	for _, key := range sortedKeys(f.Keys) {
+		if err := s.Key(key, f.Keys[key]); err != nil {
+			return nil, err
+		}
+	}
+	for _, prefix := range sortedKeys(f.Prefixes) {
+		if err := s.Prefix(prefix, f.Prefixes[prefix]); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// ParseFile reads a schema from the file at path.
+func ParseFile(path string) (*Schema, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+func sortedKeys(rules map[string]Rule) []string {
+	keys := make([]string, 0, len(rules))
+	for key := range rules {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var types = map[string]Type{"any": Any, "string": String, "integer": Integer, "float": Float, "boolean": Boolean}
+
+func (t Type) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+func (t *Type) UnmarshalText(text []byte) error {
+	v, ok := types[string(text)]
+	if !ok {
+		return fmt.Errorf("unknown type %q", text)
+	}
+	*t = v
+	return nil
+}
+
+var policies = map[string]Policy{"use_default": UseDefault, "keep_previous": KeepPrevious, "reject_snapshot": RejectSnapshot}
+
+func (p Policy) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func (p *Policy) UnmarshalText(text []byte) error {
+	v, ok := policies[string(text)]
+	if !ok {
+		return fmt.Errorf("unknown policy %q", text)
+	}
+	*p = v
+	return nil
+}
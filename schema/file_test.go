@@ -0,0 +1,41 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	assert := require.New(t)
+
+	s, err := Parse(strings.NewReader(`{
+		"keys": {
+			"svc.timeout_ms": {"type": "integer", "min": 10, "max": 1000, "required": true, "default": "250"},
+			"svc.mode": {"enum": ["fast", "safe"], "on_invalid": "reject_snapshot"}
+		},
+		"prefixes": {
+			"features.": {"type": "integer", "max": 100, "on_invalid": "keep_previous"}
+		}
+	}`))
+	assert.NoError(err)
+	assert.Equal([]string{"svc.mode", "svc.timeout_ms"}, s.Keys())
+
+	rule, ok := s.Lookup("svc.timeout_ms")
+	assert.True(ok)
+	assert.Equal(Integer, rule.Type)
+	assert.Equal(float64(10), *rule.Min)
+	assert.True(rule.Required)
+
+	assert.Equal(RejectSnapshot, s.Validate("svc.mode", "reckless").Policy)
+	assert.Equal(KeepPrevious, s.Validate("features.x", "101").Policy)
+	assert.Nil(s.Validate("features.x", "100"))
+
+	_, err = Parse(strings.NewReader(`{"keys": {"a": {"type": "int"}}}`))
+	assert.Error(err)
+	_, err = Parse(strings.NewReader(`{"keys": {"a": {"maximum": 5}}}`))
+	assert.Error(err)
+	_, err = Parse(strings.NewReader(`{"prefixes": {"a.": {"required": true}}}`))
+	assert.Error(err)
+}
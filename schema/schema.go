@@ -0,0 +1,356 @@
+// Package schema describes the runtime keys a service expects, so values that
+// are missing, mistyped or out of range can be caught when a snapshot is loaded
+// instead of when the value is used.
+package schema
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/lyft/goruntime/snapshot"
+)
+
+// Type is the type of value a runtime key must hold.
+type Type int
+
+const (
+	// Any accepts every value.
+	Any Type = iota
+	// String accepts every value. Min and Max do not apply.
+	String
+	// Integer accepts unsigned integers, as parsed by snapshot.GetInteger.
+	Integer
+	// Float accepts decimal numbers.
+	Float
+	// Boolean accepts the values accepted by strconv.ParseBool.
+	Boolean
+)
+
+func (t Type) String() string {
+	switch t {
+	case Any:
+		return "any"
+	case String:
+		return "string"
+	case Integer:
+		return "integer"
+	case Float:
+		return "float"
+	case Boolean:
+		return "boolean"
+	default:
+		return fmt.Sprintf("Type(%d)", int(t))
+	}
+}
+
+// Policy is what happens to a snapshot holding an invalid or missing value.
+type Policy int
+
+const (
+	// UseDefault replaces the value with the rule's Default, or drops the key
+	// if the rule has no Default, so callers fall back to their own default.
+	UseDefault Policy = iota
+	// KeepPrevious keeps the key's value from the current snapshot. If the
+	// current snapshot has no value for the key UseDefault applies.
+	KeepPrevious
+	// RejectSnapshot rejects the whole snapshot, keeping the current one.
+	RejectSnapshot
+)
+
+func (p Policy) String() string {
+	switch p {
+	case UseDefault:
+		return "use_default"
+	case KeepPrevious:
+		return "keep_previous"
+	case RejectSnapshot:
+		return "reject_snapshot"
+	default:
+		return fmt.Sprintf("Policy(%d)", int(p))
+	}
+}
+
+// Rule constrains the value of a runtime key. Values are checked with
+// surrounding whitespace trimmed, since runtime files usually end in a newline.
+type Rule struct {
+	Type Type `json:"type,omitempty"`
+	// Min and Max bound Integer and Float values, inclusive. Nil means unbounded.
+	Min *float64 `json:"min,omitempty"`
+	Max *float64 `json:"max,omitempty"`
+	// Enum, if not empty, lists the only values allowed.
+	Enum []string `json:"enum,omitempty"`
+	// Pattern, if set, is a regular expression the whole value must match.
+	Pattern string `json:"pattern,omitempty"`
+	// Required reports keys missing from a snapshot. Only valid for key rules.
+	Required bool `json:"required,omitempty"`
+	// Default is the value used by the UseDefault policy. Empty means none.
+	Default string `json:"default,omitempty"`
+	// OnInvalid is what happens when the value is invalid or a required key
+	// is missing.
+	OnInvalid Policy `json:"on_invalid,omitempty"`
+	// Description documents the key.
+	Description string `json:"description,omitempty"`
+}
+
+// Bound returns a pointer to v, for use in Rule.Min and Rule.Max.
+func Bound(v float64) *float64 { return &v }
+
+type compiledRule struct {
+	Rule
+	pattern *regexp.Regexp
+}
+
+type prefixRule struct {
+	prefix string
+	rule   *compiledRule
+}
+
+// Schema is a set of rules for runtime keys, registered per key or per key
+// prefix. A Schema is safe for concurrent use.
+type Schema struct {
+	mu       sync.RWMutex
+	keys     map[string]*compiledRule
+	prefixes []prefixRule
+}
+
+func New() *Schema {
+	return &Schema{keys: map[string]*compiledRule{}}
+}
+
+// Key registers rule for key. It is an error to register a key twice.
+func (s *Schema) Key(key string, rule Rule) error {
+	compiled, err := compile(key, rule)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.keys[key]; ok {
+		return fmt.Errorf("goruntime/schema: key %s registered twice", key)
+	}
+	s.keys[key] = compiled
+	return nil
+}
+
+// Prefix registers rule for every key starting with prefix that has no rule
+// of its own. When several prefixes match a key the longest one applies.
+func (s *Schema) Prefix(prefix string, rule Rule) error {
+	if rule.Required {
+		return fmt.Errorf("goruntime/schema: prefix %s: only keys can be required", prefix)
+	}
+	compiled, err := compile(prefix, rule)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.prefixes {
+		if p.prefix == prefix {
+			return fmt.Errorf("goruntime/schema: prefix %s registered twice", prefix)
+		}
+	}
+	s.prefixes = append(s.prefixes, prefixRule{prefix: prefix, rule: compiled})
+	sort.Slice(s.prefixes, func(i, j int) bool { return len(s.prefixes[i].prefix) > len(s.prefixes[j].prefix) })
+	return nil
+}
+
+// MustKey is like Key but panics on error.
+func (s *Schema) MustKey(key string, rule Rule) *Schema {
+	if err := s.Key(key, rule); err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// MustPrefix is like Prefix but panics on error.
+func (s *Schema) MustPrefix(prefix string, rule Rule) *Schema {
+	if err := s.Prefix(prefix, rule); err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func compile(name string, rule Rule) (*compiledRule, error) {
+	compiled := &compiledRule{Rule: rule}
+	if rule.Pattern != "" {
+		pattern, err := regexp.Compile("^(?:" + rule.Pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("goruntime/schema: %s: %s", name, err)
+		}
+		compiled.pattern = pattern
+	}
+	if rule.Default != "" {
+		if reason := compiled.check(rule.Default); reason != "" {
+			return nil, fmt.Errorf("goruntime/schema: %s: invalid default %q: %s", name, rule.Default, reason)
+		}
+	}
+	return compiled, nil
+}
+
+// Lookup returns the rule that applies to key.
+func (s *Schema) Lookup(key string) (Rule, bool) {
+	if rule := s.lookup(key); rule != nil {
+		return rule.Rule, true
+	}
+	return Rule{}, false
+}
+
+func (s *Schema) lookup(key string) *compiledRule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if rule, ok := s.keys[key]; ok {
+		return rule
+	}
+	for _, p := range s.prefixes {
+		if strings.HasPrefix(key, p.prefix) {
+			return p.rule
+		}
+	}
+	return nil
+}
+
+// Keys returns the keys with a rule of their own, sorted.
+func (s *Schema) Keys() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]string, 0, len(s.keys))
+	for key := range s.keys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Validate checks value against the rule for key. Keys without a rule are
+// always valid.
+func (s *Schema) Validate(key string, value string) *Error {
+	rule := s.lookup(key)
+	if rule == nil {
+		return nil
+	}
+	if reason := rule.check(value); reason != "" {
+		return &Error{Key: key, Value: value, Reason: reason, Policy: rule.OnInvalid}
+	}
+	return nil
+}
+
+// Missing returns an error for every required key not in snapshot.
+func (s *Schema) Missing(snapshot snapshot.IFace) Errors {
+	var errs Errors
+	entries := snapshot.Entries()
+	for _, key := range s.Keys() {
+		rule := s.lookup(key)
+		if _, ok := entries[key]; rule.Required && !ok {
+			errs = append(errs, &Error{Key: key, Reason: "required key is missing", Policy: rule.OnInvalid})
+		}
+	}
+	return errs
+}
+
+// ValidateSnapshot checks every value in snapshot and reports missing required
+// keys, without applying any policy.
+func (s *Schema) ValidateSnapshot(snapshot snapshot.IFace) Errors {
+	keys := snapshot.Keys()
+	sort.Strings(keys)
+
+	var errs Errors
+	for _, key := range keys {
+		if err := s.Validate(key, snapshot.Get(key)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return append(errs, s.Missing(snapshot)...)
+}
+
+// check returns why value violates the rule, or "" if it is valid.
+func (r *compiledRule) check(value string) string {
+	value = strings.TrimSpace(value)
+
+	switch r.Type {
+	case Integer:
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return "not an integer"
+		}
+		if reason := r.checkRange(float64(n)); reason != "" {
+			return reason
+		}
+	case Float:
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsNaN(n) {
+			return "not a number"
+		}
+		if reason := r.checkRange(n); reason != "" {
+			return reason
+		}
+	case Boolean:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return "not a boolean"
+		}
+	}
+
+	if len(r.Enum) > 0 {
+		found := false
+		for _, allowed := range r.Enum {
+			if value == allowed {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Sprintf("not one of %s", strings.Join(r.Enum, ", "))
+		}
+	}
+	if r.pattern != nil && !r.pattern.MatchString(value) {
+		return fmt.Sprintf("does not match %s", r.Pattern)
+	}
+	return ""
+}
+
+func (r *compiledRule) checkRange(n float64) string {
+	if r.Min != nil && n < *r.Min {
+		return fmt.Sprintf("less than %s", strconv.FormatFloat(*r.Min, 'g', -1, 64))
+	}
+	if r.Max != nil && n > *r.Max {
+		return fmt.Sprintf("greater than %s", strconv.FormatFloat(*r.Max, 'g', -1, 64))
+	}
+	return ""
+}
+
+// Error is a runtime key whose value violates its rule, or a missing
+// required key.
+type Error struct {
+	Key string
+	// Value is the invalid value, empty for missing keys.
+	Value  string
+	Reason string
+	// Policy is the OnInvalid policy of the rule that was violated.
+	Policy Policy
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("runtime key %s: %s", e.Key, e.Reason)
+}
+
+// Errors is a list of validation errors.
+type Errors []*Error
+
+func (e Errors) Error() string {
+	switch len(e) {
+	case 0:
+		return "no validation errors"
+	case 1:
+		return e[0].Error()
+	default:
+		return fmt.Sprintf("%s (and %d more)", e[0].Error(), len(e)-1)
+	}
+}
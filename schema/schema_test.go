@@ -0,0 +1,92 @@
+package schema
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lyft/goruntime/snapshot"
+	"github.com/lyft/goruntime/snapshot/entry"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	assert := require.New(t)
+
+	s := New().
+		MustKey("timeout_ms", Rule{Type: Integer, Min: Bound(10), Max: Bound(1000)}).
+		MustKey("ratio", Rule{Type: Float, Max: Bound(1)}).
+		MustKey("enabled", Rule{Type: Boolean}).
+		MustKey("mode", Rule{Enum: []string{"fast", "safe"}}).
+		MustPrefix("hosts.", Rule{Pattern: `[a-z.]+`}).
+		MustPrefix("hosts.ip.", Rule{Pattern: `[0-9.]+`})
+
+	valid := map[string]string{
+		"timeout_ms":  "250\n",
+		"ratio":       "0.5",
+		"enabled":     "true",
+		"mode":        "safe",
+		"hosts.a":     "example.com",
+		"hosts.ip.a":  "10.0.0.1",
+		"unknown.key": "anything",
+	}
+	for key, value := range valid {
+		assert.Nil(s.Validate(key, value), key)
+	}
+
+	invalid := map[string]string{
+		"timeout_ms": "5",
+		"ratio":      "1.5",
+		"enabled":    "yes please",
+		"mode":       "reckless",
+		"hosts.a":    "Example.com",
+		"hosts.ip.a": "example.com",
+	}
+	for key, value := range invalid {
+		assert.NotNil(s.Validate(key, value), key)
+	}
+
+	err := s.Validate("timeout_ms", "abc")
+	assert.Equal(&Error{Key: "timeout_ms", Value: "abc", Reason: "not an integer", Policy: UseDefault}, err)
+	assert.Equal("runtime key timeout_ms: not an integer", err.Error())
+	assert.Equal("runtime key timeout_ms: greater than 1000", s.Validate("timeout_ms", "1001").Error())
+}
+
+func TestRegister(t *testing.T) {
+	assert := require.New(t)
+
+	s := New()
+	assert.NoError(s.Key("a", Rule{Type: Integer, Default: "5"}))
+	assert.Error(s.Key("a", Rule{}))
+	assert.NoError(s.Prefix("a.", Rule{}))
+	assert.Error(s.Prefix("a.", Rule{}))
+	assert.Error(s.Prefix("b.", Rule{Required: true}))
+	assert.Error(s.Key("b", Rule{Pattern: "("}))
+	assert.Error(s.Key("c", Rule{Type: Integer, Default: "many"}))
+
+	rule, ok := s.Lookup("a.b")
+	assert.True(ok)
+	assert.Equal(Any, rule.Type)
+	_, ok = s.Lookup("b")
+	assert.False(ok)
+	assert.Equal([]string{"a"}, s.Keys())
+}
+
+func TestValidateSnapshot(t *testing.T) {
+	assert := require.New(t)
+
+	s := New().
+		MustKey("a", Rule{Type: Integer, Required: true}).
+		MustKey("b", Rule{Type: Integer, Required: true, OnInvalid: RejectSnapshot}).
+		MustKey("c", Rule{Type: Integer})
+
+	snap := snapshot.New()
+	snap.SetEntry("a", entry.New("x", time.Time{}))
+	snap.SetEntry("d", entry.New("x", time.Time{}))
+
+	errs := s.ValidateSnapshot(snap)
+	assert.Equal(Errors{
+		{Key: "a", Value: "x", Reason: "not an integer"},
+		{Key: "b", Reason: "required key is missing", Policy: RejectSnapshot},
+	}, errs)
+	assert.Equal("runtime key a: not an integer (and 1 more)", errs.Error())
+}
@@ -0,0 +1,22 @@
+package snapshot
+
+import "context"
+
+// contextKey keys the snapshot of one loader, so that snapshots of different
+// loaders are carried side by side.
+type contextKey struct {
+	loader interface{}
+}
+
+// NewContext returns a copy of ctx carrying s as the snapshot of loader, so
+// everything handling a request can read the same snapshot. loader must be
+// comparable, as pointers are.
+func NewContext(ctx context.Context, loader interface{}, s IFace) context.Context {
+	return context.WithValue(ctx, contextKey{loader}, s)
+}
+
+// FromContext returns the snapshot of loader carried by ctx, if any.
+func FromContext(ctx context.Context, loader interface{}) (IFace, bool) {
+	s, ok := ctx.Value(contextKey{loader}).(IFace)
+	return s, ok
+}
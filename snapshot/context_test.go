@@ -0,0 +1,23 @@
+package snapshot
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestContext(t *testing.T) {
+	assert := require.New(t)
+
+	loader1, loader2 := new(int), new(int)
+	_, ok := FromContext(context.Background(), loader1)
+	assert.False(ok)
+
+	ctx := NewContext(context.Background(), loader1, NewMock().Set("key", "value"))
+	pinned, ok := FromContext(ctx, loader1)
+	assert.True(ok)
+	assert.Equal("value", pinned.Get("key"))
+	_, ok = FromContext(ctx, loader2)
+	assert.False(ok)
+}
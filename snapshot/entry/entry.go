@@ -1,6 +1,10 @@
 package entry
 
-import "time"
+import (
+	"strconv"
+	"strings"
+	"time"
+)
 
 // An individual snapshot entry. Optimized for integers by pre-converting them if possible.
 type Entry struct {
@@ -9,3 +13,21 @@ type Entry struct {
 	Uint64Valid bool
 	Modified    time.Time
 }
+
+// New creates an entry for value, pre-converting it to an integer if it holds one.
+func New(value string, modified time.Time) *Entry {
+	e := &Entry{
+		StringValue: value,
+		Uint64Value: 0,
+		Uint64Valid: false,
+		Modified:    modified,
+	}
+
+	uint64Value, err := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+	if err == nil {
+		e.Uint64Value = uint64Value
+		e.Uint64Valid = true
+	}
+
+	return e
+}
@@ -59,3 +59,25 @@ type IFace interface {
 
 	SetEntry(string, *entry.Entry)
 }
+
+// MetadataSnapshot is implemented by snapshots that record how they were built,
+// such as *Snapshot and the snapshots published by loaders in this repository.
+type MetadataSnapshot interface {
+	IFace
+
+	// Metadata describes how the snapshot was built, for example the revision it
+	// was loaded from. The returned map must not be modified.
+	// @return map[string]string the snapshot metadata.
+	Metadata() map[string]string
+
+	SetMetadata(key string, value string)
+}
+
+// Metadata returns the metadata recorded in s, or nil if s does not implement
+// MetadataSnapshot.
+func Metadata(s IFace) map[string]string {
+	if m, ok := s.(MetadataSnapshot); ok {
+		return m.Metadata()
+	}
+	return nil
+}
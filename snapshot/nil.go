@@ -40,3 +40,9 @@ func (Nil) Entries() map[string]*entry.Entry {
 }
 
 func (Nil) SetEntry(string, *entry.Entry) {}
+
+func (Nil) Metadata() map[string]string {
+	return map[string]string{}
+}
+
+func (Nil) SetMetadata(string, string) {}
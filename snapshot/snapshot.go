@@ -43,12 +43,14 @@ var defaultRandomGenerator RandomGenerator = &randomGeneratorImpl{
 
 // Implementation of Snapshot for the filesystem loader.
 type Snapshot struct {
-	entries map[string]*entry.Entry
+	entries  map[string]*entry.Entry
+	metadata map[string]string
 }
 
 func New() (s *Snapshot) {
 	s = &Snapshot{
-		entries: make(map[string]*entry.Entry),
+		entries:  make(map[string]*entry.Entry),
+		metadata: make(map[string]string),
 	}
 
 	return
@@ -114,10 +116,23 @@ func (s *Snapshot) SetEntry(key string, e *entry.Entry) {
 	s.entries[key] = e
 }
 
+func (s *Snapshot) Metadata() map[string]string {
+	return s.metadata
+}
+
+func (s *Snapshot) SetMetadata(key string, value string) {
+	s.metadata[key] = value
+}
+
 func enabled(id uint64, percentage uint32, feature string) bool {
-	uid := crc(id, feature)
+	return Bucket(id, feature) < percentage
+}
 
-	return uid%100 < percentage
+// Bucket returns the bucket, 0-99, that id falls in for feature. FeatureEnabledForID
+// enables feature for id when the bucket is less than the percentage, so id is
+// first enabled at a percentage of Bucket(id, feature)+1.
+func Bucket(id uint64, feature string) uint32 {
+	return crc(id, feature) % 100
 }
 
 func crc(id uint64, feature string) uint32 {
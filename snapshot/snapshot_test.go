@@ -43,6 +43,17 @@ func TestSnapshot_FeatureEnabledForID(t *testing.T) {
 	assert.Equal(t, 47, enabled)
 }
 
+func TestBucket(t *testing.T) {
+	key := "test"
+	ss := New()
+	for id := uint64(0); id < 100; id++ {
+		bucket := Bucket(id, key)
+		assert.True(t, bucket < 100)
+		assert.False(t, ss.FeatureEnabledForID(key, id, bucket))
+		assert.True(t, ss.FeatureEnabledForID(key, id, bucket+1))
+	}
+}
+
 func TestSnapshot_FeatureEnabledForIDDisabled(t *testing.T) {
 	key := "test"
 	ss := NewMock()